@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition with the given type, or nil if it is not set
+func (s *MongoDBStatus) GetCondition(t MongoDBConditionType) *MongoDBCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsConditionTrue returns true if the condition with the given type has status True
+func (s *MongoDBStatus) IsConditionTrue(t MongoDBConditionType) bool {
+	c := s.GetCondition(t)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// SetCondition sets the condition with the given type, updating the LastTransitionTime only if the
+// status changed.  Returns true if the status of the condition changed.
+func (s *MongoDBStatus) SetCondition(t MongoDBConditionType, status corev1.ConditionStatus, reason, message string) bool {
+	c := s.GetCondition(t)
+	if c == nil {
+		s.Conditions = append(s.Conditions, MongoDBCondition{
+			Type:               t,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: metav1.Now(),
+		})
+		return true
+	}
+	changed := c.Status != status
+	if changed {
+		c.LastTransitionTime = metav1.Now()
+	}
+	c.Status = status
+	c.Reason = reason
+	c.Message = message
+	return changed
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("MongoDBStatus conditions", func() {
+	var status *MongoDBStatus
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour))
+
+	BeforeEach(func() {
+		status = &MongoDBStatus{}
+	})
+
+	It("should add missing conditions", func() {
+		Expect(status.GetCondition(ConditionPaused)).To(BeNil())
+		Expect(status.IsConditionTrue(ConditionPaused)).To(BeFalse())
+
+		Expect(status.SetCondition(ConditionPaused, corev1.ConditionTrue, "Paused", "paused")).To(BeTrue())
+		c := status.GetCondition(ConditionPaused)
+		Expect(c).NotTo(BeNil())
+		Expect(c.Status).To(Equal(corev1.ConditionTrue))
+		Expect(c.Reason).To(Equal("Paused"))
+		Expect(c.Message).To(Equal("paused"))
+		Expect(c.LastTransitionTime.IsZero()).To(BeFalse())
+		Expect(status.IsConditionTrue(ConditionPaused)).To(BeTrue())
+		Expect(status.GetCondition(ConditionRestarting)).To(BeNil())
+	})
+
+	It("should keep the transition time unless the status flips", func() {
+		status.Conditions = []MongoDBCondition{{
+			Type:               ConditionRestarting,
+			Status:             corev1.ConditionTrue,
+			Reason:             "RestartTriggered",
+			LastTransitionTime: earlier,
+		}}
+
+		Expect(status.SetCondition(ConditionRestarting, corev1.ConditionTrue, "RestartTriggered", "Restarting members")).To(BeFalse())
+		c := status.GetCondition(ConditionRestarting)
+		Expect(c.Message).To(Equal("Restarting members"))
+		Expect(c.LastTransitionTime).To(Equal(earlier))
+
+		Expect(status.SetCondition(ConditionRestarting, corev1.ConditionFalse, "RestartCompleted", "")).To(BeTrue())
+		c = status.GetCondition(ConditionRestarting)
+		Expect(c.Reason).To(Equal("RestartCompleted"))
+		Expect(c.LastTransitionTime.After(earlier.Time)).To(BeTrue())
+		Expect(status.Conditions).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// deletionWebhookPath is the path the deletion webhook is served on
+const deletionWebhookPath = "/validate-databases-example-com-v1alpha1-mongodb-delete"
+
+// +kubebuilder:webhook:path=/validate-databases-example-com-v1alpha1-mongodb-delete,mutating=false,failurePolicy=fail,groups=databases.example.com,resources=mongodbs,verbs=delete,versions=v1alpha1;v1beta1,name=vmongodb-delete.databases.example.com
+
+// SetupWebhookWithManager registers the webhook rejecting deletion of MongoDBs with the DoNotTerminate
+// termination policy
+func (r *MongoDB) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(deletionWebhookPath, &webhook.Admission{
+		Handler: &deletionValidator{reader: mgr.GetAPIReader()},
+	})
+	return nil
+}
+
+// deletionValidator rejects deletion of MongoDBs with the DoNotTerminate termination policy
+type deletionValidator struct {
+	reader  client.Reader
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &deletionValidator{}
+var _ admission.DecoderInjector = &deletionValidator{}
+
+// Handle implements admission.Handler
+func (v *deletionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1beta1.Delete {
+		return admission.Allowed("")
+	}
+
+	// The old object is only sent by apiservers from 1.15 on.  Objects of other versions are read as v1alpha1.
+	mongo := &MongoDB{}
+	if len(req.OldObject.Raw) > 0 && req.Kind.Version == GroupVersion.Version {
+		if err := v.decoder.DecodeRaw(req.OldObject, mongo); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	} else {
+		err := v.reader.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: req.Name}, mongo)
+		if apierrs.IsNotFound(err) {
+			return admission.Allowed("")
+		}
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+
+	if mongo.Spec.EffectiveTerminationPolicy() == TerminationPolicyDoNotTerminate {
+		return admission.Denied(fmt.Sprintf("terminationPolicy is %s, change it to allow deletion",
+			TerminationPolicyDoNotTerminate))
+	}
+	return admission.Allowed("")
+}
+
+// InjectDecoder implements admission.DecoderInjector
+func (v *deletionValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
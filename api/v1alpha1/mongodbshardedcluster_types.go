@@ -0,0 +1,130 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MongoDBShardedClusterSpec defines the desired state of MongoDBShardedCluster
+type MongoDBShardedClusterSpec struct {
+	// shards is the number of shard replica sets.  Shards are added by increasing it.  Removing a shard
+	// requires draining its data and is not supported, so the existing shards are kept if it is decreased.
+	// +kubebuilder:validation:Minimum=1
+	Shards int32 `json:"shards"`
+
+	// shard configures the replica set of each shard
+	// +optional
+	Shard ReplicaSetSpec `json:"shard,omitempty"`
+
+	// configServer configures the config server replica set
+	// +optional
+	ConfigServer ReplicaSetSpec `json:"configServer,omitempty"`
+
+	// mongos configures the query routers clients connect to
+	// +optional
+	Mongos MongosSpec `json:"mongos,omitempty"`
+}
+
+// ReplicaSetSpec configures a replica set of a sharded cluster
+type ReplicaSetSpec struct {
+	// replicas is the number of members, defaults to the operator configuration.  Up to seven members vote,
+	// and the number of voting members must be odd.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// storage is the size of the data volume of each member, defaults to the operator configuration.
+	// It cannot be changed once the members are created; a change is rejected as an invalid spec.
+	// +optional
+	Storage *string `json:"storage,omitempty"`
+}
+
+// MongosSpec configures the mongos query routers
+type MongosSpec struct {
+	// replicas is the number of mongos, defaults to 1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// MongoDBShardedClusterStatus defines the observed state of MongoDBShardedCluster
+type MongoDBShardedClusterStatus struct {
+	// phase is a summary of the state of the sharded cluster
+	// +optional
+	Phase MongoDBPhase `json:"phase,omitempty"`
+
+	// configServer is the state of the config server replica set
+	// +optional
+	ConfigServer ComponentStatus `json:"configServer,omitempty"`
+
+	// shards are the states of the shards
+	// +optional
+	Shards []ShardStatus `json:"shards,omitempty"`
+
+	// mongos is the state of the query routers
+	// +optional
+	Mongos ComponentStatus `json:"mongos,omitempty"`
+}
+
+// ComponentStatus is the observed state of the Pods of a component of a sharded cluster
+type ComponentStatus struct {
+	// replicas is the number of Pods
+	Replicas int32 `json:"replicas"`
+
+	// readyReplicas is the number of ready Pods
+	ReadyReplicas int32 `json:"readyReplicas"`
+}
+
+// ShardStatus is the observed state of a shard
+type ShardStatus struct {
+	ComponentStatus `json:",inline"`
+
+	// name of the shard, which is the name of its replica set
+	Name string `json:"name"`
+
+	// registered is true once the shard has been added to the cluster
+	Registered bool `json:"registered"`
+}
+
+// +kubebuilder:printcolumn:name="phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="shards",type="integer",JSONPath=".spec.shards",format="int32"
+// +kubebuilder:printcolumn:name="ready mongos",type="integer",JSONPath=".status.mongos.readyReplicas",format="int32"
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// MongoDBShardedCluster is the Schema for the mongodbshardedclusters API
+type MongoDBShardedCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MongoDBShardedClusterSpec   `json:"spec,omitempty"`
+	Status MongoDBShardedClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MongoDBShardedClusterList contains a list of MongoDBShardedCluster
+type MongoDBShardedClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MongoDBShardedCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MongoDBShardedCluster{}, &MongoDBShardedClusterList{})
+}
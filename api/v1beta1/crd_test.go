@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/yaml"
+)
+
+// prunedObjects returns the paths of the schemas below path which are objects without properties, whose fields
+// are pruned by the apiserver unless they are preserved
+func prunedObjects(path string, schema map[string]interface{}) []string {
+	var paths []string
+	properties, _ := schema["properties"].(map[string]interface{})
+	_, additional := schema["additionalProperties"]
+	preserved, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool)
+	if schema["type"] == "object" && properties == nil && !additional && !preserved {
+		paths = append(paths, path)
+	}
+	for name, property := range properties {
+		if p, ok := property.(map[string]interface{}); ok {
+			paths = append(paths, prunedObjects(path+"/properties/"+name, p)...)
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		paths = append(paths, prunedObjects(path+"/items", items)...)
+	}
+	return paths
+}
+
+// patchedCRD returns the generated MongoDB CRD with the JSON patches of config/crd/patches applied in order
+func patchedCRD(patches ...string) *crd {
+	data, err := ioutil.ReadFile("../../config/crd/bases/databases.example.com_mongodbs.yaml")
+	Expect(err).NotTo(HaveOccurred())
+	doc, err := yaml.YAMLToJSON(data)
+	Expect(err).NotTo(HaveOccurred())
+	for _, name := range patches {
+		data, err = ioutil.ReadFile("../../config/crd/patches/" + name)
+		Expect(err).NotTo(HaveOccurred())
+		ops, err := yaml.YAMLToJSON(data)
+		Expect(err).NotTo(HaveOccurred())
+		patch, err := jsonpatch.DecodePatch(ops)
+		Expect(err).NotTo(HaveOccurred())
+		doc, err = patch.Apply(doc)
+		Expect(err).NotTo(HaveOccurred(), name)
+	}
+
+	patched := &crd{}
+	Expect(json.Unmarshal(doc, patched)).To(Succeed())
+	return patched
+}
+
+// crd contains the fields of the CRD checked by the tests
+type crd struct {
+	Spec struct {
+		Versions []struct {
+			Name   string `json:"name"`
+			Served bool   `json:"served"`
+			Schema struct {
+				OpenAPIV3Schema map[string]interface{} `json:"openAPIV3Schema"`
+			} `json:"schema"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+var _ = Describe("MongoDB CRD", func() {
+	It("should preserve the free-form fields once pruning is enabled for the conversion webhook", func() {
+		patched := patchedCRD("preserve_unknown_fields_in_mongodb.yaml")
+		Expect(patched.Spec.Versions).To(HaveLen(2))
+		for i, version := range patched.Spec.Versions {
+			root := fmt.Sprintf("/spec/versions/%d/schema/openAPIV3Schema", i)
+			// The metadata of the MongoDB itself is not pruned
+			Expect(prunedObjects(root, version.Schema.OpenAPIV3Schema)).To(ConsistOf(root+"/properties/metadata"), version.Name)
+		}
+	})
+
+	It("should only serve v1beta1 together with the conversion webhook", func() {
+		patched := patchedCRD("unserve_v1beta1_in_mongodb.yaml")
+		Expect(patched.Spec.Versions[0].Name).To(Equal("v1alpha1"))
+		Expect(patched.Spec.Versions[0].Served).To(BeTrue())
+		Expect(patched.Spec.Versions[1].Name).To(Equal("v1beta1"))
+		Expect(patched.Spec.Versions[1].Served).To(BeFalse())
+
+		patched = patchedCRD("unserve_v1beta1_in_mongodb.yaml", "preserve_unknown_fields_in_mongodb.yaml", "serve_v1beta1_in_mongodb.yaml")
+		Expect(patched.Spec.Versions[1].Served).To(BeTrue())
+	})
+})
@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts the MongoDB to the v1alpha1 hub version
+func (src *MongoDB) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*v1alpha1.MongoDB)
+	dst.ObjectMeta = src.ObjectMeta
+
+	s := &src.Spec
+	dst.Spec = v1alpha1.MongoDBSpec{
+		Type:                   v1alpha1.MongoDBType(s.Topology.Type),
+		Replicas:               s.Topology.Replicas,
+		Storage:                s.Storage.Size,
+		PodTemplate:            s.PodTemplate,
+		AdditionalMongodConfig: s.AdditionalMongodConfig,
+		TerminationPolicy:      v1alpha1.TerminationPolicy(s.TerminationPolicy),
+		FinalBackup:            (*v1alpha1.FinalBackupSpec)(s.FinalBackup),
+		Adopt:                  (*v1alpha1.AdoptSpec)(s.Adopt),
+		Arbiters:               (*v1alpha1.ArbitersSpec)(s.Topology.Arbiters),
+		HiddenMembers:          (*v1alpha1.HiddenMembersSpec)(s.Topology.HiddenMembers),
+		DelayedMembers:         (*v1alpha1.DelayedMembersSpec)(s.Topology.DelayedMembers),
+		ExternalAccess:         (*v1alpha1.ExternalAccessSpec)(s.ExternalAccess),
+		NetworkPolicy:          (*v1alpha1.NetworkPolicySpec)(s.NetworkPolicy),
+		DriftPolicy:            v1alpha1.DriftPolicy(s.DriftPolicy),
+	}
+	if o := s.StatefulSetOverrides; o != nil {
+		dst.Spec.StatefulSetOverrides = &v1alpha1.StatefulSetOverrides{
+			Labels:      o.Labels,
+			Annotations: o.Annotations,
+			Spec:        (*v1alpha1.StatefulSetSpecOverrides)(o.Spec),
+		}
+	}
+	if m := s.Monitoring; m != nil {
+		dst.Spec.Monitoring = &v1alpha1.MonitoringSpec{
+			Enabled:        m.Enabled,
+			Image:          m.Image,
+			Port:           m.Port,
+			Resources:      m.Resources,
+			ServiceMonitor: (*v1alpha1.ServiceMonitorSpec)(m.ServiceMonitor),
+		}
+	}
+	if s.Topology.MemberConfig != nil {
+		dst.Spec.MemberConfig = make([]v1alpha1.MemberConfigSpec, len(s.Topology.MemberConfig))
+		for i, c := range s.Topology.MemberConfig {
+			dst.Spec.MemberConfig[i] = v1alpha1.MemberConfigSpec(c)
+		}
+	}
+
+	st := &src.Status
+	dst.Status = v1alpha1.MongoDBStatus{
+		StatefulSetStatus:        st.StatefulSetStatus,
+		ServiceStatus:            st.ServiceStatus,
+		Phase:                    v1alpha1.MongoDBPhase(st.Phase),
+		CurrentImage:             st.CurrentImage,
+		ExternalConnectionString: st.ExternalConnectionString,
+	}
+	if rs := st.ReplicaSet; rs != nil {
+		dst.Status.ReplicaSet = &v1alpha1.ReplicaSetStatus{Initialized: rs.Initialized, Primary: rs.Primary}
+		if rs.Members != nil {
+			dst.Status.ReplicaSet.Members = make([]v1alpha1.MemberStatus, len(rs.Members))
+			for i, m := range rs.Members {
+				dst.Status.ReplicaSet.Members[i] = v1alpha1.MemberStatus{
+					Name:    m.Name,
+					Type:    v1alpha1.MemberType(m.Type),
+					State:   m.State,
+					Healthy: m.Healthy,
+				}
+			}
+		}
+	}
+	if st.Conditions != nil {
+		dst.Status.Conditions = make([]v1alpha1.MongoDBCondition, len(st.Conditions))
+		for i, c := range st.Conditions {
+			dst.Status.Conditions[i] = v1alpha1.MongoDBCondition{
+				Type:               v1alpha1.MongoDBConditionType(c.Type),
+				Status:             c.Status,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts the v1alpha1 hub version to the MongoDB
+func (dst *MongoDB) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*v1alpha1.MongoDB)
+	dst.ObjectMeta = src.ObjectMeta
+
+	s := &src.Spec
+	dst.Spec = MongoDBSpec{
+		Topology: TopologySpec{
+			Type:           MongoDBType(s.Type),
+			Replicas:       s.Replicas,
+			Arbiters:       (*ArbitersSpec)(s.Arbiters),
+			HiddenMembers:  (*HiddenMembersSpec)(s.HiddenMembers),
+			DelayedMembers: (*DelayedMembersSpec)(s.DelayedMembers),
+		},
+		Storage:                StorageSpec{Size: s.Storage},
+		PodTemplate:            s.PodTemplate,
+		AdditionalMongodConfig: s.AdditionalMongodConfig,
+		TerminationPolicy:      TerminationPolicy(s.TerminationPolicy),
+		FinalBackup:            (*FinalBackupSpec)(s.FinalBackup),
+		Adopt:                  (*AdoptSpec)(s.Adopt),
+		ExternalAccess:         (*ExternalAccessSpec)(s.ExternalAccess),
+		NetworkPolicy:          (*NetworkPolicySpec)(s.NetworkPolicy),
+		DriftPolicy:            DriftPolicy(s.DriftPolicy),
+	}
+	if o := s.StatefulSetOverrides; o != nil {
+		dst.Spec.StatefulSetOverrides = &StatefulSetOverrides{
+			Labels:      o.Labels,
+			Annotations: o.Annotations,
+			Spec:        (*StatefulSetSpecOverrides)(o.Spec),
+		}
+	}
+	if m := s.Monitoring; m != nil {
+		dst.Spec.Monitoring = &MonitoringSpec{
+			Enabled:        m.Enabled,
+			Image:          m.Image,
+			Port:           m.Port,
+			Resources:      m.Resources,
+			ServiceMonitor: (*ServiceMonitorSpec)(m.ServiceMonitor),
+		}
+	}
+	if s.MemberConfig != nil {
+		dst.Spec.Topology.MemberConfig = make([]MemberConfigSpec, len(s.MemberConfig))
+		for i, c := range s.MemberConfig {
+			dst.Spec.Topology.MemberConfig[i] = MemberConfigSpec(c)
+		}
+	}
+
+	st := &src.Status
+	dst.Status = MongoDBStatus{
+		StatefulSetStatus:        st.StatefulSetStatus,
+		ServiceStatus:            st.ServiceStatus,
+		Phase:                    MongoDBPhase(st.Phase),
+		CurrentImage:             st.CurrentImage,
+		ExternalConnectionString: st.ExternalConnectionString,
+	}
+	if rs := st.ReplicaSet; rs != nil {
+		dst.Status.ReplicaSet = &ReplicaSetStatus{Initialized: rs.Initialized, Primary: rs.Primary}
+		if rs.Members != nil {
+			dst.Status.ReplicaSet.Members = make([]MemberStatus, len(rs.Members))
+			for i, m := range rs.Members {
+				dst.Status.ReplicaSet.Members[i] = MemberStatus{
+					Name:    m.Name,
+					Type:    MemberType(m.Type),
+					State:   m.State,
+					Healthy: m.Healthy,
+				}
+			}
+		}
+	}
+	if st.Conditions != nil {
+		dst.Status.Conditions = make([]MongoDBCondition, len(st.Conditions))
+		for i, c := range st.Conditions {
+			dst.Status.Conditions[i] = MongoDBCondition{
+				Type:               MongoDBConditionType(c.Type),
+				Status:             c.Status,
+				LastTransitionTime: c.LastTransitionTime,
+				Reason:             c.Reason,
+				Message:            c.Message,
+			}
+		}
+	}
+	return nil
+}
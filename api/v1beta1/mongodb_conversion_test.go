@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	fuzz "github.com/google/gofuzz"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// fuzzer fills the MongoDBs with random values.  Objects with unexported fields, which gofuzz cannot fill, are
+// given fixed values.
+func fuzzer() *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.2).NumElements(0, 2).Funcs(
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+		func(m *metav1.ObjectMeta, c fuzz.Continue) {
+			m.Name = c.RandString()
+			m.Namespace = c.RandString()
+			c.Fuzz(&m.Labels)
+			c.Fuzz(&m.Annotations)
+		},
+		func(r *runtime.RawExtension, c fuzz.Continue) {
+			r.Raw = []byte(`{"net":{"maxIncomingConnections":` + c.RandString() + `}}`)
+		},
+		func(tm *metav1.TypeMeta, c fuzz.Continue) {},
+	)
+}
+
+var _ = Describe("MongoDB conversion", func() {
+	It("should round trip v1beta1 through the hub", func() {
+		f := fuzzer()
+		for i := 0; i < 1000; i++ {
+			src := &MongoDB{}
+			f.Fuzz(src)
+
+			hub := &v1alpha1.MongoDB{}
+			Expect(src.ConvertTo(hub)).To(Succeed())
+			dst := &MongoDB{}
+			Expect(dst.ConvertFrom(hub)).To(Succeed())
+			Expect(equality.Semantic.DeepEqual(src, dst)).To(BeTrue(), "lost fields converting %#v", src)
+		}
+	})
+
+	It("should round trip the hub through v1beta1", func() {
+		f := fuzzer()
+		for i := 0; i < 1000; i++ {
+			src := &v1alpha1.MongoDB{}
+			f.Fuzz(src)
+
+			spoke := &MongoDB{}
+			Expect(spoke.ConvertFrom(src)).To(Succeed())
+			dst := &v1alpha1.MongoDB{}
+			Expect(spoke.ConvertTo(dst)).To(Succeed())
+			Expect(equality.Semantic.DeepEqual(src, dst)).To(BeTrue(), "lost fields converting %#v", src)
+		}
+	})
+
+	It("should move the members and storage into their blocks", func() {
+		replicas := int32(3)
+		storage := "10Gi"
+		hub := &v1alpha1.MongoDB{Spec: v1alpha1.MongoDBSpec{
+			Type:     v1alpha1.TypeReplicaSet,
+			Replicas: &replicas,
+			Storage:  &storage,
+			Arbiters: &v1alpha1.ArbitersSpec{Replicas: 1},
+		}}
+
+		spoke := &MongoDB{}
+		Expect(spoke.ConvertFrom(hub)).To(Succeed())
+		Expect(spoke.Spec.Topology.Type).To(Equal(TypeReplicaSet))
+		Expect(*spoke.Spec.Topology.Replicas).To(Equal(int32(3)))
+		Expect(spoke.Spec.Topology.Arbiters.Replicas).To(Equal(int32(1)))
+		Expect(*spoke.Spec.Storage.Size).To(Equal("10Gi"))
+	})
+})
@@ -0,0 +1,478 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MongoDBSpec defines the desired state of MongoDB.  Unlike v1alpha1 the members are configured in the topology
+// block and their data volumes in the storage block.
+type MongoDBSpec struct {
+	// topology configures the type and members of the MongoDB
+	// +optional
+	Topology TopologySpec `json:"topology,omitempty"`
+
+	// storage configures the data volumes of the members
+	// +optional
+	Storage StorageSpec `json:"storage,omitempty"`
+
+	// podTemplate is strategically merged on top of the Pod template generated for the StatefulSet.
+	// It may be used to add environment variables, annotations, sidecars, a service account, etc.
+	// +optional
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+
+	// statefulSetOverrides is strategically merged on top of the generated StatefulSet.
+	// +optional
+	StatefulSetOverrides *StatefulSetOverrides `json:"statefulSetOverrides,omitempty"`
+
+	// additionalMongodConfig is free-form configuration matching the mongod.conf format.  It is merged with
+	// the configuration owned by the operator and rendered into a ConfigMap mounted into the pods.
+	// Changing it triggers a rolling restart.
+	// +optional
+	AdditionalMongodConfig *runtime.RawExtension `json:"additionalMongodConfig,omitempty"`
+
+	// monitoring configures a Prometheus exporter for the MongoDB
+	// +optional
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+
+	// terminationPolicy controls what happens to the data when the MongoDB is deleted, defaults to Halt.
+	// DoNotTerminate rejects the deletion only if the operator serves its admission webhooks.  Without them the
+	// MongoDB is marked as deleted and only its finalization is blocked: the members keep running, but the MongoDB
+	// cannot be recreated under the same name until the terminationPolicy is changed.
+	// +kubebuilder:validation:Enum=DoNotTerminate;Halt;Delete;WipeOut
+	// +optional
+	TerminationPolicy TerminationPolicy `json:"terminationPolicy,omitempty"`
+
+	// finalBackup is taken before the data is deleted by the Delete and WipeOut termination policies
+	// +optional
+	FinalBackup *FinalBackupSpec `json:"finalBackup,omitempty"`
+
+	// adopt takes over an existing StatefulSet and Service instead of generating new ones.  The immutable
+	// fields of the StatefulSet are kept and the Pods are rolled to the generated template one at a time.
+	// +optional
+	Adopt *AdoptSpec `json:"adopt,omitempty"`
+
+	// externalAccess exposes every member to clients outside the cluster through its own Service.  The external
+	// addresses are configured as the external horizon of the replica set, so clients connecting with TLS to
+	// the external connection string published in the status discover the external addresses of the members.
+	// +optional
+	ExternalAccess *ExternalAccessSpec `json:"externalAccess,omitempty"`
+
+	// networkPolicy restricts the connections to the members to the other members, the operator and the declared
+	// clients.  The port of the exporter stays open to scrapers.
+	// +optional
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// driftPolicy controls what happens to changes made by others to the fields of the generated objects set by
+	// the operator, e.g. with kubectl edit.  Changes are reported by the DriftDetected condition and an event
+	// either way.  Defaults to Correct.
+	// +kubebuilder:validation:Enum=Correct;Report
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+}
+
+// TopologySpec configures the type and members of a MongoDB
+type TopologySpec struct {
+	// type is ReplicaSet to run the members as a replica set, or Standalone to run a single mongod without
+	// replication, e.g. for development and CI.  Defaults to ReplicaSet.
+	// +kubebuilder:validation:Enum=Standalone;ReplicaSet
+	// +optional
+	Type MongoDBType `json:"type,omitempty"`
+
+	// replicas is the number of data members.  Up to seven members vote, and together with the arbiters the
+	// number of voting members must be odd.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// arbiters vote in elections but hold no data, e.g. for a cheap 2+1 topology.  They run in a separate
+	// StatefulSet without persistent storage.
+	// +optional
+	Arbiters *ArbitersSpec `json:"arbiters,omitempty"`
+
+	// hiddenMembers replicate the data but are invisible to clients and never become primary, e.g. for
+	// analytics.  They run in a separate StatefulSet and do not vote.
+	// +optional
+	HiddenMembers *HiddenMembersSpec `json:"hiddenMembers,omitempty"`
+
+	// delayedMembers are hidden members replicating the data with a delay, e.g. to recover from bad deletes.
+	// They run in a separate StatefulSet and do not vote.
+	// +optional
+	DelayedMembers *DelayedMembersSpec `json:"delayedMembers,omitempty"`
+
+	// memberConfig sets the priority, votes and tags of data members selected by the ordinal of their Pod or the
+	// zone of its node, e.g. to pin the primary to a preferred zone or to tag members for read preferences.
+	// Later entries take precedence over earlier ones.  Ordinals must select data members, and the resulting
+	// configuration must have an odd number of voting members.
+	// +optional
+	MemberConfig []MemberConfigSpec `json:"memberConfig,omitempty"`
+}
+
+// StorageSpec configures the data volumes of a MongoDB
+type StorageSpec struct {
+	// size of the data volume of each data member, e.g. 100Gi, or ephemeral to use an emptyDir.
+	// It cannot be changed once the members are created; a change is rejected as an invalid spec.
+	// +optional
+	Size *string `json:"size,omitempty"`
+}
+
+// NetworkPolicySpec configures the NetworkPolicy generated for the members
+type NetworkPolicySpec struct {
+	// clients are the peers allowed to connect to the members, e.g. Pods selected by namespace and labels.  Clients
+	// outside the cluster connecting through externalAccess are only allowed if their addresses are listed by an
+	// ipBlock.
+	// +optional
+	Clients []networkingv1.NetworkPolicyPeer `json:"clients,omitempty"`
+}
+
+// ExternalAccessSpec configures the Services exposing the members outside the cluster
+type ExternalAccessSpec struct {
+	// type of the Services, LoadBalancer or NodePort.  NodePort members are reached through the address of the
+	// node running them.
+	// +kubebuilder:validation:Enum=LoadBalancer;NodePort
+	Type corev1.ServiceType `json:"type"`
+
+	// annotations added to the Services, e.g. to configure the cloud load balancer
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// MemberConfigSpec configures the data members selected by either ordinal or zone
+type MemberConfigSpec struct {
+	// ordinal of the Pod running the member
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Ordinal *int32 `json:"ordinal,omitempty"`
+
+	// zone of the node running the member, matching its topology.kubernetes.io/zone or
+	// failure-domain.beta.kubernetes.io/zone label
+	// +optional
+	Zone string `json:"zone,omitempty"`
+
+	// priority of the member in elections, 0 prevents it from becoming primary
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000
+	// +optional
+	Priority *int32 `json:"priority,omitempty"`
+
+	// votes of the member in elections.  Members with priority must vote.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1
+	// +optional
+	Votes *int32 `json:"votes,omitempty"`
+
+	// tags of the member used by read preferences and write concerns
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// ArbitersSpec configures the arbiters of the replica set
+type ArbitersSpec struct {
+	// replicas is the number of arbiters.  MongoDB recommends a single arbiter per replica set.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1
+	Replicas int32 `json:"replicas"`
+}
+
+// HiddenMembersSpec configures the hidden members of the replica set
+type HiddenMembersSpec struct {
+	// replicas is the number of hidden members
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+
+	// storage is the size of the data volume of each member, defaults to spec.storage.size.
+	// It cannot be changed once the members are created; a change is rejected as an invalid spec.
+	// +optional
+	Storage *string `json:"storage,omitempty"`
+}
+
+// DelayedMembersSpec configures the delayed members of the replica set
+type DelayedMembersSpec struct {
+	// replicas is the number of delayed members
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+
+	// storage is the size of the data volume of each member, defaults to spec.storage.size.
+	// It cannot be changed once the members are created; a change is rejected as an invalid spec.
+	// +optional
+	Storage *string `json:"storage,omitempty"`
+
+	// delaySeconds is how far the members lag behind the primary, defaults to 3600
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	DelaySeconds *int32 `json:"delaySeconds,omitempty"`
+}
+
+// MongoDBType is the topology of a MongoDB
+type MongoDBType string
+
+const (
+	// TypeStandalone runs a single mongod without replication
+	TypeStandalone MongoDBType = "Standalone"
+
+	// TypeReplicaSet runs the members as a replica set
+	TypeReplicaSet MongoDBType = "ReplicaSet"
+)
+
+// AdoptSpec references the existing objects taken over by the operator
+type AdoptSpec struct {
+	// statefulSetName of the existing StatefulSet running the members
+	StatefulSetName string `json:"statefulSetName"`
+
+	// serviceName of the existing governing Service of the StatefulSet
+	ServiceName string `json:"serviceName"`
+}
+
+// DriftPolicy controls what happens to changes made by others to the generated objects
+type DriftPolicy string
+
+const (
+	// DriftPolicyCorrect applies the generated objects over the changes
+	DriftPolicyCorrect DriftPolicy = "Correct"
+
+	// DriftPolicyReport keeps the changes until the MongoDB changes
+	DriftPolicyReport DriftPolicy = "Report"
+)
+
+// TerminationPolicy controls what happens to the data when the MongoDB is deleted
+type TerminationPolicy string
+
+const (
+	// TerminationPolicyDoNotTerminate rejects deletion of the MongoDB with the deletion webhook.  Without the
+	// webhook, the TerminationFinalizer keeps the MongoDB and its objects until the terminationPolicy is changed.
+	TerminationPolicyDoNotTerminate TerminationPolicy = "DoNotTerminate"
+
+	// TerminationPolicyHalt deletes the generated objects but keeps the PersistentVolumeClaims and Secrets
+	TerminationPolicyHalt TerminationPolicy = "Halt"
+
+	// TerminationPolicyDelete also deletes the PersistentVolumeClaims but keeps the Secrets
+	TerminationPolicyDelete TerminationPolicy = "Delete"
+
+	// TerminationPolicyWipeOut also deletes the Secrets referenced by the podTemplate which belong to the MongoDB,
+	// i.e. are controlled by it or carry its selector labels.  Secrets owned by the user are never deleted.
+	TerminationPolicyWipeOut TerminationPolicy = "WipeOut"
+)
+
+// FinalBackupSpec configures the backup taken before the data is deleted
+type FinalBackupSpec struct {
+	// claimName of the PersistentVolumeClaim the mongodump archive is written to
+	ClaimName string `json:"claimName"`
+
+	// image running mongodump, defaults to the mongo image
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// MonitoringSpec configures the Prometheus exporter sidecar injected into the MongoDB pods
+type MonitoringSpec struct {
+	// enabled injects a mongodb exporter sidecar into the pods and exposes its metrics port on the Service
+	Enabled bool `json:"enabled"`
+
+	// image of the exporter sidecar
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// port the exporter serves metrics on, defaults to 9216
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// resources of the exporter sidecar
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// serviceMonitor configures a ServiceMonitor for the Prometheus Operator.  It is only created if the
+	// ServiceMonitor CRD is installed.
+	// +optional
+	ServiceMonitor *ServiceMonitorSpec `json:"serviceMonitor,omitempty"`
+}
+
+// ServiceMonitorSpec configures the generated ServiceMonitor
+type ServiceMonitorSpec struct {
+	// enabled creates a ServiceMonitor selecting the metrics port of the Service
+	Enabled bool `json:"enabled"`
+
+	// interval at which metrics are scraped, e.g. 30s
+	// +optional
+	Interval string `json:"interval,omitempty"`
+
+	// labels added to the ServiceMonitor so that it is selected by a Prometheus instance
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// StatefulSetOverrides contains the fields of the generated StatefulSet that may be overridden
+type StatefulSetOverrides struct {
+	// labels are added to the StatefulSet labels
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// annotations are added to the StatefulSet annotations
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// spec is merged on top of the generated StatefulSet spec
+	// +optional
+	Spec *StatefulSetSpecOverrides `json:"spec,omitempty"`
+}
+
+// StatefulSetSpecOverrides contains the fields of the generated StatefulSet spec that may be overridden
+type StatefulSetSpecOverrides struct {
+	// podManagementPolicy cannot be changed once the StatefulSet is created
+	// +optional
+	PodManagementPolicy appsv1.PodManagementPolicyType `json:"podManagementPolicy,omitempty"`
+
+	// +optional
+	UpdateStrategy *appsv1.StatefulSetUpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// revisionHistoryLimit cannot be changed once the StatefulSet is created
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// volumeClaimTemplates are merged by name with the generated volume claim templates.  They cannot be
+	// changed once the StatefulSet is created; a change is rejected as an invalid spec.
+	// +optional
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+}
+
+// MongoDBStatus defines the observed state of MongoDB
+type MongoDBStatus struct {
+	// statefulSetStatus contains the status of the StatefulSet managed by MongoDB
+	StatefulSetStatus appsv1.StatefulSetStatus `json:"statefulSetStatus,omitempty"`
+
+	// serviceStatus contains the status of the Service managed by MongoDB
+	ServiceStatus corev1.ServiceStatus `json:"serviceStatus,omitempty"`
+
+	// phase is a summary of the state of the MongoDB
+	// +optional
+	Phase MongoDBPhase `json:"phase,omitempty"`
+
+	// currentImage is the mongo image run by all members once the latest rollout completed
+	// +optional
+	CurrentImage string `json:"currentImage,omitempty"`
+
+	// replicaSet is the observed state of the replica set
+	// +optional
+	ReplicaSet *ReplicaSetStatus `json:"replicaSet,omitempty"`
+
+	// externalConnectionString connects clients outside the cluster to the members exposed by externalAccess
+	// +optional
+	ExternalConnectionString string `json:"externalConnectionString,omitempty"`
+
+	// conditions are the latest observations of the state of the MongoDB
+	// +optional
+	Conditions []MongoDBCondition `json:"conditions,omitempty"`
+}
+
+// ReplicaSetStatus is the observed state of the replica set
+type ReplicaSetStatus struct {
+	// initialized is true once the replica set has been initiated
+	Initialized bool `json:"initialized"`
+
+	// primary is the host:port of the primary member
+	// +optional
+	Primary string `json:"primary,omitempty"`
+
+	// members of the replica set
+	// +optional
+	Members []MemberStatus `json:"members,omitempty"`
+}
+
+// MemberStatus is the observed state of a replica set member
+type MemberStatus struct {
+	// name is the host:port of the member
+	Name string `json:"name"`
+
+	// type of the member
+	// +optional
+	Type MemberType `json:"type,omitempty"`
+
+	// state of the member, e.g. PRIMARY or SECONDARY
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// healthy is true if the member is reachable
+	Healthy bool `json:"healthy"`
+}
+
+// MemberType is the kind of a replica set member, one of Data, Arbiter, Hidden or Delayed
+type MemberType string
+
+// MongoDBPhase is a summary of the state of the MongoDB, one of Pending, Progressing, Ready or Paused
+type MongoDBPhase string
+
+// MongoDBConditionType is a valid value for MongoDBCondition.Type
+type MongoDBConditionType string
+
+// MongoDBCondition describes the state of a MongoDB at a certain point
+type MongoDBCondition struct {
+	// type of the condition
+	Type MongoDBConditionType `json:"type"`
+
+	// status of the condition, one of True, False, Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// lastTransitionTime is the last time the condition transitioned from one status to another
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// reason is a brief CamelCase reason for the condition's last transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// message is a human readable message indicating details about the transition
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:printcolumn:name="phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="type",type="string",JSONPath=".spec.topology.type"
+// +kubebuilder:printcolumn:name="storage",type="string",JSONPath=".spec.storage.size",format="byte"
+// +kubebuilder:printcolumn:name="replicas",type="integer",JSONPath=".spec.topology.replicas",format="int32"
+// +kubebuilder:printcolumn:name="ready replicas",type="integer",JSONPath=".status.statefulSetStatus.readyReplicas",format="int32"
+// +kubebuilder:printcolumn:name="current replicas",type="integer",JSONPath=".status.statefulSetStatus.currentReplicas",format="int32"
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:scale:specpath=.spec.topology.replicas,statuspath=.status.statefulSetStatus.replicas
+// +kubebuilder:subresource:status
+
+// MongoDB is the Schema for the mongodbs API
+type MongoDB struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MongoDBSpec   `json:"spec,omitempty"`
+	Status MongoDBStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MongoDBList contains a list of MongoDB
+type MongoDBList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MongoDB `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MongoDB{}, &MongoDBList{})
+}
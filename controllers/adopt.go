@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// adoptedStatefulSet returns the existing StatefulSet referenced by spec.adopt once it is verified that it can
+// be taken over without data loss, or nil if the MongoDB does not adopt a StatefulSet
+func (r *MongoDBReconciler) adoptedStatefulSet(ctx context.Context, mongo *v1alpha1.MongoDB) (*appsv1.StatefulSet, error) {
+	adopt := mongo.Spec.Adopt
+	if adopt == nil {
+		return nil, nil
+	}
+
+	ss := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: mongo.Namespace, Name: adopt.StatefulSetName}, ss)
+	if apierrs.IsNotFound(err) {
+		return nil, fmt.Errorf("StatefulSet %s to adopt not found", adopt.StatefulSetName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if owner := metav1.GetControllerOf(ss); owner != nil && owner.UID != mongo.UID {
+		return nil, fmt.Errorf("StatefulSet %s is already controlled by %s %s", ss.Name, owner.Kind, owner.Name)
+	}
+	if ss.Spec.ServiceName != adopt.ServiceName {
+		return nil, fmt.Errorf("StatefulSet %s is governed by Service %q, not %q", ss.Name, ss.Spec.ServiceName, adopt.ServiceName)
+	}
+	if err := util.CheckAdoptable(ss); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+// recordAdoption logs and emits an event when an existing object was taken over
+func (r *MongoDBReconciler) recordAdoption(log logr.Logger, mongo *v1alpha1.MongoDB, kind string, obj metav1.Object) {
+	log.Info("adopted "+kind, "name", obj.GetName())
+	r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonAdopted, "Adopted %s %s", kind, obj.GetName())
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// isPaused returns true if the reconcile of the MongoDB is paused with the paused annotation
+func isPaused(mongo *v1alpha1.MongoDB) bool {
+	return mongo.Annotations[v1alpha1.PausedAnnotation] == "true"
+}
+
+// setPausedCondition records whether the reconcile is paused, emitting an event on transitions
+func (r *MongoDBReconciler) setPausedCondition(mongo *v1alpha1.MongoDB, paused bool) {
+	if paused {
+		if mongo.Status.SetCondition(v1alpha1.ConditionPaused, corev1.ConditionTrue, ReasonPaused,
+			"Changes to the generated objects are paused by the "+v1alpha1.PausedAnnotation+" annotation") {
+			r.Recorder.Event(mongo, corev1.EventTypeWarning, ReasonPaused, "Reconcile paused, generated objects will not be changed")
+		}
+		return
+	}
+	if mongo.Status.GetCondition(v1alpha1.ConditionPaused) == nil {
+		return
+	}
+	if mongo.Status.SetCondition(v1alpha1.ConditionPaused, corev1.ConditionFalse, ReasonResumed, "") {
+		r.Recorder.Event(mongo, corev1.EventTypeNormal, ReasonResumed, "Reconcile resumed")
+	}
+}
+
+// setRestartingCondition records whether a restart requested with the restartedAt annotation is still
+// rolling through the members, emitting an event once it completes
+func (r *MongoDBReconciler) setRestartingCondition(mongo *v1alpha1.MongoDB, ss *appsv1.StatefulSet) {
+	restartedAt := mongo.Annotations[v1alpha1.RestartedAtAnnotation]
+	if restartedAt == "" || ss.Spec.Template.Annotations[v1alpha1.RestartedAtAnnotation] != restartedAt {
+		return
+	}
+
+	if isRollingOut(ss) {
+		mongo.Status.SetCondition(v1alpha1.ConditionRestarting, corev1.ConditionTrue, ReasonRestartTriggered,
+			"Restarting members for restart requested at "+restartedAt)
+		return
+	}
+	if mongo.Status.IsConditionTrue(v1alpha1.ConditionRestarting) {
+		r.Recorder.Event(mongo, corev1.EventTypeNormal, ReasonRestartCompleted, "Restarted all members for restart requested at "+restartedAt)
+	}
+	mongo.Status.SetCondition(v1alpha1.ConditionRestarting, corev1.ConditionFalse, ReasonRestartCompleted,
+		"Restarted all members for restart requested at "+restartedAt)
+}
+
+// setUpgradingCondition records whether a change of the mongo image is still rolling through the members,
+// and the image run by all members once the rollout completes
+func (r *MongoDBReconciler) setUpgradingCondition(mongo *v1alpha1.MongoDB, ss *appsv1.StatefulSet) {
+	image := util.ContainerImage(&ss.Spec.Template, "mongo")
+	if isRollingOut(ss) {
+		if mongo.Status.CurrentImage != "" && mongo.Status.CurrentImage != image {
+			mongo.Status.SetCondition(v1alpha1.ConditionUpgrading, corev1.ConditionTrue, ReasonUpgradeStarted,
+				"Upgrading members from "+mongo.Status.CurrentImage+" to "+image)
+		}
+		return
+	}
+	if mongo.Status.IsConditionTrue(v1alpha1.ConditionUpgrading) {
+		upgrades.WithLabelValues(resultSucceeded).Inc()
+		r.Recorder.Event(mongo, corev1.EventTypeNormal, ReasonUpgradeSucceeded, "Upgraded all members to "+image)
+		mongo.Status.SetCondition(v1alpha1.ConditionUpgrading, corev1.ConditionFalse, ReasonUpgradeSucceeded,
+			"Upgraded all members to "+image)
+	}
+	mongo.Status.CurrentImage = image
+}
+
+// isRollingOut returns true if the StatefulSet has not finished rolling out its latest revision
+func isRollingOut(ss *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if ss.Spec.Replicas != nil {
+		replicas = *ss.Spec.Replicas
+	}
+	return ss.Status.ObservedGeneration < ss.Generation ||
+		ss.Status.CurrentRevision != ss.Status.UpdateRevision ||
+		ss.Status.UpdatedReplicas < replicas
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("annotations", func() {
+	var r *MongoDBReconciler
+	var recorder *record.FakeRecorder
+	var mongo *v1alpha1.MongoDB
+	var ss *appsv1.StatefulSet
+
+	// rolledOut sets the status of ss to a completed rollout of its template
+	rolledOut := func() {
+		ss.Status = appsv1.StatefulSetStatus{
+			ObservedGeneration: ss.Generation,
+			CurrentRevision:    "foo-2",
+			UpdateRevision:     "foo-2",
+			UpdatedReplicas:    *ss.Spec.Replicas,
+		}
+	}
+	// rollingOut sets the status of ss to a rollout of its template which updated one member
+	rollingOut := func() {
+		ss.Status = appsv1.StatefulSetStatus{
+			ObservedGeneration: ss.Generation,
+			CurrentRevision:    "foo-1",
+			UpdateRevision:     "foo-2",
+			UpdatedReplicas:    1,
+		}
+	}
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		r = &MongoDBReconciler{Recorder: recorder}
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		replicas := int32(3)
+		ss = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-statefulset", Namespace: "default", Generation: 2},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "mongo", Image: "mongo:4.0"}},
+				}},
+			},
+		}
+		rolledOut()
+	})
+
+	It("should tell whether the StatefulSet is rolling out", func() {
+		Expect(isRollingOut(ss)).To(BeFalse())
+
+		rollingOut()
+		Expect(isRollingOut(ss)).To(BeTrue())
+
+		rolledOut()
+		ss.Status.ObservedGeneration = 1
+		Expect(isRollingOut(ss)).To(BeTrue())
+	})
+
+	It("should emit events only when the reconcile is paused or resumed", func() {
+		Expect(isPaused(mongo)).To(BeFalse())
+		r.setPausedCondition(mongo, false)
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionPaused)).To(BeNil())
+
+		mongo.Annotations = map[string]string{v1alpha1.PausedAnnotation: "true"}
+		Expect(isPaused(mongo)).To(BeTrue())
+		r.setPausedCondition(mongo, true)
+		r.setPausedCondition(mongo, true)
+		Expect(mongo.Status.IsConditionTrue(v1alpha1.ConditionPaused)).To(BeTrue())
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring(ReasonPaused))
+
+		r.setPausedCondition(mongo, false)
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionPaused).Status).To(Equal(corev1.ConditionFalse))
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring(ReasonResumed))
+	})
+
+	It("should track a requested restart until it rolled through the members", func() {
+		mongo.Annotations = map[string]string{v1alpha1.RestartedAtAnnotation: "2019-06-01T00:00:00Z"}
+
+		// The restart is not applied to the Pod template yet
+		r.setRestartingCondition(mongo, ss)
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionRestarting)).To(BeNil())
+
+		ss.Spec.Template.Annotations = map[string]string{v1alpha1.RestartedAtAnnotation: "2019-06-01T00:00:00Z"}
+		rollingOut()
+		r.setRestartingCondition(mongo, ss)
+		Expect(mongo.Status.IsConditionTrue(v1alpha1.ConditionRestarting)).To(BeTrue())
+		Expect(recorder.Events).To(BeEmpty())
+
+		rolledOut()
+		r.setRestartingCondition(mongo, ss)
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionRestarting).Reason).To(Equal(ReasonRestartCompleted))
+		Expect(mongo.Status.IsConditionTrue(v1alpha1.ConditionRestarting)).To(BeFalse())
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring(ReasonRestartCompleted))
+
+		r.setRestartingCondition(mongo, ss)
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should track an upgrade until all members run the new image", func() {
+		r.setUpgradingCondition(mongo, ss)
+		Expect(mongo.Status.CurrentImage).To(Equal("mongo:4.0"))
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionUpgrading)).To(BeNil())
+
+		ss.Spec.Template.Spec.Containers[0].Image = "mongo:4.2"
+		rollingOut()
+		r.setUpgradingCondition(mongo, ss)
+		Expect(mongo.Status.IsConditionTrue(v1alpha1.ConditionUpgrading)).To(BeTrue())
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionUpgrading).Message).To(ContainSubstring("from mongo:4.0 to mongo:4.2"))
+		Expect(mongo.Status.CurrentImage).To(Equal("mongo:4.0"))
+
+		rolledOut()
+		r.setUpgradingCondition(mongo, ss)
+		Expect(mongo.Status.GetCondition(v1alpha1.ConditionUpgrading).Reason).To(Equal(ReasonUpgradeSucceeded))
+		Expect(mongo.Status.CurrentImage).To(Equal("mongo:4.2"))
+		Expect(recorder.Events).To(HaveLen(1))
+		Expect(<-recorder.Events).To(ContainSubstring(ReasonUpgradeSucceeded))
+	})
+})
@@ -0,0 +1,174 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// FieldManager owns the fields of the generated objects set by the operator
+const FieldManager = "kubebuilder-workshop"
+
+// invalidSpecError is returned by the mutate functions of apply if the spec cannot be applied to the existing
+// object, so that it is not retried until the spec changes
+type invalidSpecError struct {
+	error
+}
+
+// checkImmutableFields returns an invalidSpecError if ss changes fields of the existing StatefulSet which cannot
+// be updated, e.g. the volume claim templates after spec.storage changed.  existing is nil if the StatefulSet
+// does not exist.
+func checkImmutableFields(ss, existing *appsv1.StatefulSet) error {
+	if existing == nil {
+		return nil
+	}
+	paths, err := util.ImmutableFieldChanges(ss, existing)
+	if err != nil {
+		return err
+	}
+	if len(paths) > 0 {
+		return invalidSpecError{fmt.Errorf("fields of the existing StatefulSet %s cannot be changed: %s",
+			existing.Name, strings.Join(paths, ", "))}
+	}
+	return nil
+}
+
+// apply creates or updates obj with server-side apply, which is enabled by default from Kubernetes 1.16 and
+// requires the ServerSideApply feature gate on 1.14 and 1.15.  Unlike ctrl.CreateOrUpdate, f mutates an object
+// that only has the name and namespace of obj set, so the applied object contains only the fields owned by the
+// operator: fields set by others, e.g. sidecars injected by a service mesh or resources set by a
+// VerticalPodAutoscaler, are kept, while fields the operator no longer sets are removed unless another manager
+// owns them too.  Conflicting fields are taken over.  obj is updated with the applied object.
+//
+// Objects written by earlier versions of the operator, which updated them, keep the fields of those updates owned
+// by the update manager named after the operator's user agent.  Applying shares these fields with FieldManager
+// rather than moving them, so fields the operator stopped setting since the upgrade are left in place until they
+// are removed by hand, e.g. with kubectl edit.
+//
+// If drift is not nil, the hash of the applied fields is recorded on the object so that fields changed by others
+// since are added to drift.  The changes are kept, and obj is updated with the live object, unless drift
+// corrects them.
+func apply(ctx context.Context, c client.Client, scheme *runtime.Scheme, obj runtime.Object, drift *driftReport, f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	key := client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}
+
+	existing, err := emptyObject(scheme, obj, gvk)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	existingAccessor, err := meta.Accessor(existing)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	if err := c.Get(ctx, key, existing); err != nil && !apierrs.IsNotFound(err) {
+		return controllerutil.OperationResultNone, err
+	}
+	resourceVersion := existingAccessor.GetResourceVersion()
+
+	// Start from an empty object so that fields read before, e.g. the status or the managed fields, are not applied
+	empty, err := emptyObject(scheme, obj, gvk)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	emptyAccessor, err := meta.Accessor(empty)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	emptyAccessor.SetNamespace(key.Namespace)
+	emptyAccessor.SetName(key.Name)
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(empty).Elem())
+
+	if err := f(); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	if drift != nil {
+		hash, err := util.AppliedHash(obj)
+		if err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		annotations := accessor.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[util.AppliedHashAnnotation] = hash
+		accessor.SetAnnotations(annotations)
+
+		// Differences to an object applied from the same fields were made by others
+		if resourceVersion != "" && existingAccessor.GetAnnotations()[util.AppliedHashAnnotation] == hash {
+			paths, err := util.Drift(obj, existing)
+			if err != nil {
+				return controllerutil.OperationResultNone, err
+			}
+			if len(paths) > 0 {
+				drift.add(gvk.Kind, key.Name, paths)
+				if !drift.correct {
+					reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(existing).Elem())
+					return controllerutil.OperationResultNone, nil
+				}
+			}
+		}
+	}
+	if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	switch {
+	case resourceVersion == "":
+		return controllerutil.OperationResultCreated, nil
+	case accessor.GetResourceVersion() != resourceVersion:
+		return controllerutil.OperationResultUpdated, nil
+	}
+	return controllerutil.OperationResultNone, nil
+}
+
+// emptyObject returns a new object of the same type as obj with only the kind set
+func emptyObject(scheme *runtime.Scheme, obj runtime.Object, gvk schema.GroupVersionKind) (runtime.Object, error) {
+	if _, ok := obj.(*unstructured.Unstructured); ok {
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		return u, nil
+	}
+	empty, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	empty.GetObjectKind().SetGroupVersionKind(gvk)
+	return empty, nil
+}
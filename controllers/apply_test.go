@@ -0,0 +1,276 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// recordedPatch is a patch sent to an applyRecorder
+type recordedPatch struct {
+	patchType types.PatchType
+	options   *client.PatchOptions
+	data      []byte
+}
+
+// applyRecorder records the patches sent to a fake client.  The fake client does not support apply patches, so
+// the patched object replaces the stored one and its resourceVersion is incremented as by the API server.
+type applyRecorder struct {
+	client.Client
+	patches []recordedPatch
+}
+
+func (c *applyRecorder) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOptionFunc) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	options := &client.PatchOptions{}
+	options.ApplyOptions(opts)
+	c.patches = append(c.patches, recordedPatch{patchType: patch.Type(), options: options, data: data})
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	existing := obj.DeepCopyObject()
+	err = c.Client.Get(ctx, client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, existing)
+	if apierrs.IsNotFound(err) {
+		accessor.SetResourceVersion("1")
+		return c.Client.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	existingAccessor, err := meta.Accessor(existing)
+	if err != nil {
+		return err
+	}
+	resourceVersion, err := strconv.Atoi(existingAccessor.GetResourceVersion())
+	if err != nil {
+		return err
+	}
+	accessor.SetResourceVersion(strconv.Itoa(resourceVersion + 1))
+	return c.Client.Update(ctx, obj)
+}
+
+// newScheme returns a scheme with the Kubernetes types and the types of the operator
+func newScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	Expect(scheme.AddToScheme(s)).To(Succeed())
+	Expect(v1alpha1.AddToScheme(s)).To(Succeed())
+	return s
+}
+
+// deleteRecorder records the objects deleted through a client and the options of the deletes
+type deleteRecorder struct {
+	client.Client
+	deleted []string
+	options []*client.DeleteOptions
+}
+
+func (c *deleteRecorder) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	c.deleted = append(c.deleted, accessor.GetName())
+	c.options = append(c.options, (&client.DeleteOptions{}).ApplyOptions(opts))
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+var _ = Describe("apply", func() {
+	var c *applyRecorder
+	var configMap *corev1.ConfigMap
+	setData := func() error {
+		configMap.Data = map[string]string{"mongod.conf": "net:\n  port: 27017\n"}
+		return nil
+	}
+
+	BeforeEach(func() {
+		c = &applyRecorder{Client: fake.NewFakeClientWithScheme(scheme.Scheme)}
+		configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config", Namespace: "default"}}
+	})
+
+	It("should create the object with an apply patch owned by the operator", func() {
+		op, err := apply(context.Background(), c, scheme.Scheme, configMap, nil, setData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultCreated))
+
+		Expect(c.patches).To(HaveLen(1))
+		Expect(c.patches[0].patchType).To(Equal(types.ApplyPatchType))
+		Expect(c.patches[0].options.FieldManager).To(Equal(FieldManager))
+		Expect(c.patches[0].options.Force).NotTo(BeNil())
+		Expect(*c.patches[0].options.Force).To(BeTrue())
+	})
+
+	It("should apply only the fields set by the operator", func() {
+		existing := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "foo-mongodb-config",
+				Namespace:       "default",
+				ResourceVersion: "7",
+				Labels:          map[string]string{"team": "db"},
+			},
+			Data: map[string]string{"extra.conf": "", "mongod.conf": ""},
+		}
+		Expect(c.Create(context.Background(), existing)).To(Succeed())
+
+		op, err := apply(context.Background(), c, scheme.Scheme, configMap, nil, setData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op).To(Equal(controllerutil.OperationResultUpdated))
+
+		Expect(c.patches).To(HaveLen(1))
+		applied := &corev1.ConfigMap{}
+		Expect(json.Unmarshal(c.patches[0].data, applied)).To(Succeed())
+		Expect(applied.Kind).To(Equal("ConfigMap"))
+		Expect(applied.ResourceVersion).To(BeEmpty())
+		Expect(applied.Labels).To(BeEmpty())
+		Expect(applied.Data).To(Equal(map[string]string{"mongod.conf": "net:\n  port: 27017\n"}))
+	})
+
+	It("should not apply the StatefulSet fields set by others", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		setFields := func(ss *appsv1.StatefulSet) func() error {
+			return func() error {
+				util.SetStatefulSetFields(ss, service, configMap, mongo, nil, nil, operatorconfig.Default())
+				return nil
+			}
+		}
+
+		// A sidecar, a toleration and an annotation were added to the generated StatefulSet by others
+		existing := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-statefulset", Namespace: "default"}}
+		Expect(setFields(existing)()).To(Succeed())
+		existing.ResourceVersion = "7"
+		existing.Annotations = map[string]string{"sidecar.istio.io/status": "injected"}
+		existing.Spec.Template.Spec.Containers = append(existing.Spec.Template.Spec.Containers,
+			corev1.Container{Name: "istio-proxy", Image: "istio/proxyv2"})
+		existing.Spec.Template.Spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+		Expect(c.Create(context.Background(), existing)).To(Succeed())
+
+		ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-statefulset", Namespace: "default"}}
+		_, err := apply(context.Background(), c, scheme.Scheme, ss, nil, setFields(ss))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.patches).To(HaveLen(1))
+		applied := &appsv1.StatefulSet{}
+		Expect(json.Unmarshal(c.patches[0].data, applied)).To(Succeed())
+		Expect(applied.Annotations).NotTo(HaveKey("sidecar.istio.io/status"))
+		Expect(applied.Spec.Template.Spec.Tolerations).To(BeEmpty())
+		for _, container := range applied.Spec.Template.Spec.Containers {
+			Expect(container.Name).NotTo(Equal("istio-proxy"))
+		}
+	})
+
+	Context("with drift detection", func() {
+		var existing *corev1.ConfigMap
+
+		BeforeEach(func() {
+			// The hash is taken of the applied object, which has its kind set
+			configMap.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+			Expect(setData()).To(Succeed())
+			hash, err := util.AppliedHash(configMap)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The applied fields were changed by others since
+			existing = configMap.DeepCopy()
+			existing.ResourceVersion = "7"
+			existing.Annotations = map[string]string{util.AppliedHashAnnotation: hash}
+			existing.Data["mongod.conf"] = "net:\n  port: 27018\n"
+			Expect(c.Create(context.Background(), existing)).To(Succeed())
+			configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config", Namespace: "default"}}
+		})
+
+		It("should keep and report the changes", func() {
+			drift := &driftReport{}
+			op, err := apply(context.Background(), c, scheme.Scheme, configMap, drift, setData)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op).To(Equal(controllerutil.OperationResultNone))
+
+			Expect(c.patches).To(BeEmpty())
+			Expect(drift.objects).To(Equal([]string{"ConfigMap foo-mongodb-config: data.mongod.conf"}))
+			Expect(configMap.Data).To(Equal(existing.Data))
+		})
+
+		It("should correct the changes", func() {
+			drift := &driftReport{correct: true}
+			op, err := apply(context.Background(), c, scheme.Scheme, configMap, drift, setData)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op).To(Equal(controllerutil.OperationResultUpdated))
+
+			Expect(c.patches).To(HaveLen(1))
+			Expect(drift.objects).To(HaveLen(1))
+			Expect(configMap.Data).To(Equal(map[string]string{"mongod.conf": "net:\n  port: 27017\n"}))
+			Expect(configMap.Annotations).To(HaveKey(util.AppliedHashAnnotation))
+		})
+	})
+})
+
+var _ = Describe("checkImmutableFields", func() {
+	var ss *appsv1.StatefulSet
+
+	BeforeEach(func() {
+		ss = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-statefulset", Namespace: "default"},
+			Spec: appsv1.StatefulSetSpec{
+				ServiceName: "foo-mongodb-service",
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+					ObjectMeta: metav1.ObjectMeta{Name: "mongo-persistent-storage"},
+					Spec: corev1.PersistentVolumeClaimSpec{Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+					}},
+				}},
+			},
+		}
+	})
+
+	It("should accept new and unchanged StatefulSets", func() {
+		Expect(checkImmutableFields(ss, nil)).To(Succeed())
+		Expect(checkImmutableFields(ss, ss.DeepCopy())).To(Succeed())
+	})
+
+	It("should reject changed volume claim templates as an invalid spec", func() {
+		existing := ss.DeepCopy()
+		ss.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("20Gi")
+
+		err := checkImmutableFields(ss, existing)
+		Expect(err).To(BeAssignableToTypeOf(invalidSpecError{}))
+		Expect(err.Error()).To(ContainSubstring("spec.volumeClaimTemplates[0].spec.resources.requests.storage"))
+	})
+})
@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// defaults returns the current operator configuration, or the compiled in defaults if there is no
+// configuration file
+func (r *MongoDBReconciler) defaults() *operatorconfig.Config {
+	return currentDefaults(r.Defaults)
+}
+
+// currentDefaults returns the current configuration of the watcher, or the compiled in defaults if it is nil
+func currentDefaults(w *operatorconfig.Watcher) *operatorconfig.Config {
+	if w == nil {
+		return operatorconfig.Default()
+	}
+	return w.Config()
+}
+
+// defaultsChanged returns a source that triggers a reconcile of every selected MongoDB when the operator
+// configuration is reloaded, so that the new defaults are applied to the generated objects
+func (r *MongoDBReconciler) defaultsChanged() source.Source {
+	events := make(chan event.GenericEvent)
+	r.Defaults.OnChange(func() {
+		list := &v1alpha1.MongoDBList{}
+		if err := r.List(context.Background(), list); err != nil {
+			r.Log.Error(err, "unable to list MongoDBs after the operator configuration changed")
+			return
+		}
+		for i := range list.Items {
+			mongo := &list.Items[i]
+			if r.selects(mongo) {
+				events <- event.GenericEvent{Meta: mongo, Object: mongo}
+			}
+		}
+	})
+	return &source.Channel{Source: events}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxDriftPaths is the number of changed fields listed per object in the DriftDetected condition
+const maxDriftPaths = 5
+
+// driftReport collects the generated objects of a MongoDB whose fields set by the operator were changed by others
+// since they were applied
+type driftReport struct {
+	// correct applies the generated objects over the changes, otherwise they are only reported
+	correct bool
+
+	// objects summarizes the changed fields of each object
+	objects []string
+}
+
+// newDriftReport returns an empty driftReport following the driftPolicy of the MongoDB
+func newDriftReport(mongo *v1alpha1.MongoDB) *driftReport {
+	return &driftReport{correct: mongo.Spec.EffectiveDriftPolicy() == v1alpha1.DriftPolicyCorrect}
+}
+
+// add records the changed fields of an object
+func (d *driftReport) add(kind, name string, paths []string) {
+	drifts.WithLabelValues(kind).Inc()
+	summary := strings.Join(paths, ", ")
+	if len(paths) > maxDriftPaths {
+		summary = fmt.Sprintf("%s and %d more", strings.Join(paths[:maxDriftPaths], ", "), len(paths)-maxDriftPaths)
+	}
+	d.objects = append(d.objects, fmt.Sprintf("%s %s: %s", kind, name, summary))
+}
+
+// setDriftCondition records the changes found by the reconcile, emitting an event when changes are corrected or
+// first reported
+func (r *MongoDBReconciler) setDriftCondition(mongo *v1alpha1.MongoDB, d *driftReport) {
+	previous := mongo.Status.GetCondition(v1alpha1.ConditionDriftDetected)
+	if len(d.objects) == 0 {
+		if previous == nil {
+			return
+		}
+		if previous.Status == corev1.ConditionTrue && previous.Reason == ReasonDriftReported {
+			r.Recorder.Event(mongo, corev1.EventTypeNormal, ReasonDriftResolved, "Generated objects match the applied fields")
+		}
+		mongo.Status.SetCondition(v1alpha1.ConditionDriftDetected, corev1.ConditionFalse, ReasonDriftResolved, "")
+		return
+	}
+
+	message := strings.Join(d.objects, "; ")
+	if d.correct {
+		r.Recorder.Event(mongo, corev1.EventTypeWarning, ReasonDriftCorrected, "Reverted changes made outside the operator to "+message)
+		mongo.Status.SetCondition(v1alpha1.ConditionDriftDetected, corev1.ConditionTrue, ReasonDriftCorrected, message)
+		return
+	}
+	if previous == nil || previous.Status != corev1.ConditionTrue || previous.Message != message {
+		r.Recorder.Event(mongo, corev1.EventTypeWarning, ReasonDriftReported, "Kept changes made outside the operator to "+message)
+	}
+	mongo.Status.SetCondition(v1alpha1.ConditionDriftDetected, corev1.ConditionTrue, ReasonDriftReported, message)
+}
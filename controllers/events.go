@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Reasons for the events emitted on MongoDB and MongoDBShardedCluster objects.  Alerting may key off these values, so they must not
+// be changed.
+const (
+	// ReasonServiceCreated is emitted when the Service is created
+	ReasonServiceCreated = "ServiceCreated"
+	// ReasonServiceUpdated is emitted when the Service is updated
+	ReasonServiceUpdated = "ServiceUpdated"
+	// ReasonConfigMapCreated is emitted when the mongod configuration ConfigMap is created
+	ReasonConfigMapCreated = "ConfigMapCreated"
+	// ReasonConfigMapUpdated is emitted when the mongod configuration ConfigMap is updated
+	ReasonConfigMapUpdated = "ConfigMapUpdated"
+	// ReasonStatefulSetCreated is emitted when the StatefulSet is created
+	ReasonStatefulSetCreated = "StatefulSetCreated"
+	// ReasonStatefulSetUpdated is emitted when the StatefulSet is updated
+	ReasonStatefulSetUpdated = "StatefulSetUpdated"
+	// ReasonNetworkPolicyCreated is emitted when the NetworkPolicy of the members is created
+	ReasonNetworkPolicyCreated = "NetworkPolicyCreated"
+	// ReasonNetworkPolicyUpdated is emitted when the NetworkPolicy of the members is updated
+	ReasonNetworkPolicyUpdated = "NetworkPolicyUpdated"
+	// ReasonExternalClientsBlocked is emitted when the NetworkPolicy allows no ipBlock although the members are
+	// exposed by externalAccess
+	ReasonExternalClientsBlocked = "ExternalClientsBlocked"
+	// ReasonDeploymentCreated is emitted when the mongos Deployment is created
+	ReasonDeploymentCreated = "DeploymentCreated"
+	// ReasonDeploymentUpdated is emitted when the mongos Deployment is updated
+	ReasonDeploymentUpdated = "DeploymentUpdated"
+	// ReasonAdopted is emitted when an existing StatefulSet or Service referenced by spec.adopt is taken over
+	ReasonAdopted = "Adopted"
+	// ReasonStatefulSetMigrated is emitted when a StatefulSet with an outdated selector is recreated
+	ReasonStatefulSetMigrated = "StatefulSetMigrated"
+	// ReasonScaled is emitted when the number of members changes
+	ReasonScaled = "Scaled"
+
+	// ReasonReplicaSetInitiated is emitted when the replica set is first observed as initiated
+	ReasonReplicaSetInitiated = "ReplicaSetInitiated"
+	// ReasonMemberAdded is emitted when a member joins the replica set
+	ReasonMemberAdded = "MemberAdded"
+	// ReasonMemberRemoved is emitted when a member leaves the replica set
+	ReasonMemberRemoved = "MemberRemoved"
+	// ReasonMemberPromoted is emitted when a member is given its votes and priority after it caught up
+	ReasonMemberPromoted = "MemberPromoted"
+	// ReasonSteppedDown is emitted when the primary steps down because its member is removed
+	ReasonSteppedDown = "SteppedDown"
+	// ReasonMembersDeleted is emitted when the StatefulSet of arbiters, hidden or delayed members removed from the
+	// spec is deleted
+	ReasonMembersDeleted = "MembersDeleted"
+	// ReasonShardAdded is emitted when a shard is registered with the sharded cluster
+	ReasonShardAdded = "ShardAdded"
+	// ReasonShardRemovalUnsupported is emitted when the number of shards is decreased
+	ReasonShardRemovalUnsupported = "ShardRemovalUnsupported"
+	// ReasonPrimaryChanged is emitted when a different member becomes primary
+	ReasonPrimaryChanged = "PrimaryChanged"
+	// ReasonNoPrimary is emitted when the replica set loses its primary
+	ReasonNoPrimary = "NoPrimary"
+
+	// ReasonUpgradeStarted is emitted when a change of the mongo image starts rolling through the members
+	ReasonUpgradeStarted = "UpgradeStarted"
+	// ReasonUpgradeSucceeded is emitted when all members run the new mongo image
+	ReasonUpgradeSucceeded = "UpgradeSucceeded"
+	// ReasonUpgradeFailed is emitted when the new mongo image could not be applied
+	ReasonUpgradeFailed = "UpgradeFailed"
+
+	// ReasonPaused is emitted when the reconcile is paused with the paused annotation
+	ReasonPaused = "Paused"
+	// ReasonResumed is emitted when the paused annotation is removed
+	ReasonResumed = "Resumed"
+	// ReasonRestartTriggered is emitted when the restartedAt annotation triggers a rolling restart
+	ReasonRestartTriggered = "RestartTriggered"
+	// ReasonRestartCompleted is emitted when all members have been restarted
+	ReasonRestartCompleted = "RestartCompleted"
+
+	// ReasonDriftCorrected is emitted when changes made by others to the generated objects are reverted
+	ReasonDriftCorrected = "DriftCorrected"
+	// ReasonDriftReported is emitted when changes made by others to the generated objects are kept by the
+	// Report driftPolicy
+	ReasonDriftReported = "DriftReported"
+	// ReasonDriftResolved is emitted when the generated objects match the applied fields again
+	ReasonDriftResolved = "DriftResolved"
+
+	// ReasonDeletionBlocked is emitted when the terminationPolicy prevents deletion of the MongoDB
+	ReasonDeletionBlocked = "DeletionBlocked"
+	// ReasonBackupStarted is emitted when the final backup is started
+	ReasonBackupStarted = "BackupStarted"
+	// ReasonBackupSucceeded is emitted when the final backup completes
+	ReasonBackupSucceeded = "BackupSucceeded"
+	// ReasonBackupFailed is emitted when the final backup fails, blocking deletion
+	ReasonBackupFailed = "BackupFailed"
+	// ReasonDataDeleted is emitted when the terminationPolicy deleted the PersistentVolumeClaims or Secrets
+	ReasonDataDeleted = "DataDeleted"
+
+	// ReasonInvalidSpec is emitted when the MongoDB spec cannot be applied
+	ReasonInvalidSpec = "InvalidSpec"
+	// ReasonReconcileFailed is emitted when a step of the reconcile fails
+	ReasonReconcileFailed = "ReconcileFailed"
+)
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileExternalAccess generates a Service exposing each desired member of the memberSets outside the cluster
+// and sets their horizons to the external addresses of the members.  Services of removed members, or all of them
+// once externalAccess is unset, are deleted.  The external connection string is published in the status once all
+// members have an external address.
+func (r *MongoDBReconciler) reconcileExternalAccess(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, sets []*memberSet, defaults *operatorconfig.Config, drift *driftReport) error {
+	defer observeStep("external", time.Now())
+
+	spec := mongo.Spec.ExternalAccess
+	wanted := map[string]bool{}
+	complete := true
+	for _, set := range sets {
+		set.horizons = nil
+		if spec == nil {
+			continue
+		}
+		for i := int32(0); i < set.desired; i++ {
+			pod := fmt.Sprintf("%s-%d", set.ss.Name, i)
+			service := &corev1.Service{
+				ObjectMeta: ctrl.ObjectMeta{Name: util.ExternalServiceName(pod), Namespace: mongo.Namespace},
+			}
+			wanted[service.Name] = true
+			op, err := apply(ctx, r.Client, r.Scheme, service, drift, func() error {
+				util.SetExternalServiceFields(service, mongo, set.component, pod, spec)
+				util.SetDefaultMetadata(service, defaults)
+				return controllerutil.SetControllerReference(mongo, service, r.Scheme)
+			})
+			if err != nil {
+				return err
+			}
+			r.recordOperation(log, mongo, op, "Service", service, ReasonServiceCreated, ReasonServiceUpdated)
+
+			nodeAddress := ""
+			if service.Spec.Type == corev1.ServiceTypeNodePort {
+				nodeAddress = r.nodeAddress(ctx, log, mongo.Namespace, pod)
+			}
+			address := util.ExternalAddress(service, nodeAddress)
+			if address == "" {
+				log.V(1).Info("waiting for external address of member", "pod", pod, "service", service.Name)
+				complete = false
+			}
+			set.horizons = append(set.horizons, address)
+		}
+	}
+
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(mongo.Namespace),
+		client.MatchingLabels(util.SelectorLabels(mongo, util.ComponentExternal))); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		service := &services.Items[i]
+		if wanted[service.Name] || !metav1.IsControlledBy(service, mongo) {
+			continue
+		}
+		if err := r.Delete(ctx, service); err != nil && !apierrs.IsNotFound(err) {
+			return err
+		}
+		log.Info("deleted Service", "name", service.Name)
+	}
+
+	mongo.Status.ExternalConnectionString = ""
+	if spec != nil && complete {
+		replSetName := sets[0].replSetName
+		if mongo.Spec.IsStandalone() {
+			replSetName = ""
+		}
+		mongo.Status.ExternalConnectionString = util.ExternalConnectionString(sets[0].horizons, replSetName)
+	}
+	return nil
+}
+
+// nodeAddress returns the address of the node running the Pod, or "" if it is not scheduled yet
+func (r *MongoDBReconciler) nodeAddress(ctx context.Context, log logr.Logger, namespace, name string) string {
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, pod); err != nil || pod.Spec.NodeName == "" {
+		return ""
+	}
+	node := &corev1.Node{}
+	if err := r.membership().reader.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+		log.V(1).Info("unable to get address of node", "pod", name, "node", pod.Spec.NodeName, "error", err.Error())
+		return ""
+	}
+	return util.NodeAddress(node)
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// memberSet is a StatefulSet running replica set members of a single type
+type memberSet struct {
+	memberType v1alpha1.MemberType
+	component  string
+	service    *corev1.Service
+	ss         *appsv1.StatefulSet
+
+	// storage is the size of the data volumes, nil for the default
+	storage *string
+
+	// replSetName is the name of the replica set run by the members
+	replSetName string
+
+	// configServer is true if the members are the config servers of a sharded cluster
+	configServer bool
+
+	// member is the configuration of the members in the replica set, without the host
+	member replicaset.MemberConfig
+
+	// desired is the number of members wanted in the replica set
+	desired int32
+
+	// current is the number of replicas of the existing StatefulSet, 0 if it does not exist
+	current int32
+	exists  bool
+
+	// live is the existing StatefulSet, nil if it does not exist
+	live *appsv1.StatefulSet
+
+	// replicas of the StatefulSet.  It is kept above desired until the removed members left the replica set.
+	replicas int32
+
+	// horizons are the external addresses of the desired members indexed by ordinal, nil without external access.
+	// The address of a member is "" until its Service is assigned one.
+	horizons []string
+}
+
+// memberSets returns the StatefulSets running the members of the MongoDB, starting with the data members running
+// in ss.  The arbiters, hidden and delayed members are always returned so that their StatefulSets are scaled
+// down and deleted once they are removed from the spec.
+func (r *MongoDBReconciler) memberSets(ctx context.Context, mongo *v1alpha1.MongoDB, service *corev1.Service, ss *appsv1.StatefulSet, defaults *operatorconfig.Config) ([]*memberSet, error) {
+	data := &memberSet{
+		memberType:  v1alpha1.MemberTypeData,
+		component:   util.ComponentReplicaSet,
+		service:     service,
+		ss:          ss,
+		replSetName: util.ReplicaSetName,
+		storage:     mongo.Spec.Storage,
+		member:      replicaset.MemberConfig{Votes: 1, Priority: 1},
+		desired:     defaults.Replicas,
+	}
+	if mongo.Spec.Replicas != nil {
+		data.desired = *mongo.Spec.Replicas
+	}
+	if mongo.Spec.IsStandalone() {
+		// Ignore the default replicas of the operator configuration
+		data.desired = 1
+	}
+	arbiters := r.newMemberSet(mongo, v1alpha1.MemberTypeArbiter, util.ComponentArbiter)
+	arbiters.member = replicaset.MemberConfig{ArbiterOnly: true, Votes: 1}
+	if spec := mongo.Spec.Arbiters; spec != nil {
+		arbiters.desired = spec.Replicas
+	}
+	hidden := r.newMemberSet(mongo, v1alpha1.MemberTypeHidden, util.ComponentHidden)
+	hidden.member = replicaset.MemberConfig{Hidden: true}
+	if spec := mongo.Spec.HiddenMembers; spec != nil {
+		hidden.desired = spec.Replicas
+		hidden.storage = storageOrDefault(spec.Storage, mongo.Spec.Storage)
+	}
+	delayed := r.newMemberSet(mongo, v1alpha1.MemberTypeDelayed, util.ComponentDelayed)
+	delayed.member = replicaset.MemberConfig{Hidden: true}
+	if spec := mongo.Spec.DelayedMembers; spec != nil {
+		delayed.desired = spec.Replicas
+		delayed.storage = storageOrDefault(spec.Storage, mongo.Spec.Storage)
+		delayed.member.SlaveDelay = int64(spec.EffectiveDelaySeconds())
+	}
+
+	sets := []*memberSet{data, arbiters, hidden, delayed}
+	if err := loadMemberSets(ctx, r, sets); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// loadMemberSets reads the current replicas of the existing StatefulSets of the memberSets
+func loadMemberSets(ctx context.Context, c client.Reader, sets []*memberSet) error {
+	for _, set := range sets {
+		existing := &appsv1.StatefulSet{}
+		err := c.Get(ctx, types.NamespacedName{Namespace: set.ss.Namespace, Name: set.ss.Name}, existing)
+		if apierrs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		set.exists = true
+		set.live = existing
+		if existing.Spec.Replicas != nil {
+			set.current = *existing.Spec.Replicas
+		}
+	}
+	return nil
+}
+
+// newMemberSet returns the memberSet of the component without members
+func (r *MongoDBReconciler) newMemberSet(mongo *v1alpha1.MongoDB, memberType v1alpha1.MemberType, component string) *memberSet {
+	name := util.MemberSetName(mongo, component)
+	return &memberSet{
+		memberType:  memberType,
+		component:   component,
+		replSetName: util.ReplicaSetName,
+		service:     &corev1.Service{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: mongo.Namespace}},
+		ss:          &appsv1.StatefulSet{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: mongo.Namespace}},
+	}
+}
+
+// liveAnnotations returns the annotations of the existing StatefulSet, recording the default images of its
+// containers
+func (set *memberSet) liveAnnotations() map[string]string {
+	if set.live == nil {
+		return nil
+	}
+	return set.live.Annotations
+}
+
+// storageOrDefault returns storage if set, otherwise def
+func storageOrDefault(storage, def *string) *string {
+	if storage != nil {
+		return storage
+	}
+	return def
+}
+
+// reconcileMemberSets generates the StatefulSets and Services of the arbiters, hidden and delayed members.  They
+// are deleted once all their members have been removed from the replica set.  The data volumes of hidden and
+// delayed members are kept.
+func (r *MongoDBReconciler) reconcileMemberSets(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, sets []*memberSet, configMap *corev1.ConfigMap, referencesHash, restartedAt string, defaults *operatorconfig.Config, drift *driftReport) error {
+	for _, set := range sets {
+		if set.replicas == 0 && set.desired == 0 {
+			if !set.exists {
+				continue
+			}
+			if err := r.deleteMemberSet(ctx, log, mongo, set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		start := time.Now()
+		op, err := apply(ctx, r.Client, r.Scheme, set.service, drift, func() error {
+			util.SetMemberServiceFields(set.service, mongo, set.component)
+			util.SetDefaultMetadata(set.service, defaults)
+			return controllerutil.SetControllerReference(mongo, set.service, r.Scheme)
+		})
+		observeStep("service", start)
+		if err != nil {
+			return err
+		}
+		r.recordOperation(log, mongo, op, "Service", set.service, ReasonServiceCreated, ReasonServiceUpdated)
+
+		start = time.Now()
+		op, err = apply(ctx, r.Client, r.Scheme, set.ss, drift, func() error {
+			replicas := set.replicas
+			util.SetMemberStatefulSetFields(set.ss, set.service, configMap, mongo, set.component, &replicas, set.storage, defaults)
+			util.PinDefaultImages(set.ss, &set.ss.Spec.Template, set.liveAnnotations())
+			if err := util.MergeStatefulSetOverrides(set.ss, mongo.Spec.PodTemplate, nil); err != nil {
+				return err
+			}
+			if err := checkImmutableFields(set.ss, set.live); err != nil {
+				return err
+			}
+			if referencesHash != "" {
+				set.ss.Spec.Template.Annotations[util.ReferencesHashAnnotation] = referencesHash
+			}
+			if restartedAt != "" {
+				set.ss.Spec.Template.Annotations[v1alpha1.RestartedAtAnnotation] = restartedAt
+			}
+			return controllerutil.SetControllerReference(mongo, set.ss, r.Scheme)
+		})
+		observeStep("statefulset", start)
+		if err != nil {
+			return err
+		}
+		r.recordOperation(log, mongo, op, "StatefulSet", set.ss, ReasonStatefulSetCreated, ReasonStatefulSetUpdated)
+	}
+	return nil
+}
+
+// deleteMemberSet deletes the StatefulSet and Service of a memberSet removed from the spec
+func (r *MongoDBReconciler) deleteMemberSet(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, set *memberSet) error {
+	for _, obj := range []runtime.Object{set.ss, set.service} {
+		if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrs.IsNotFound(err) {
+			return err
+		}
+	}
+	log.Info("deleted members", "type", set.memberType, "statefulSet", set.ss.Name)
+	r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonMembersDeleted, "Deleted StatefulSet %s running the %s members", set.ss.Name, set.memberType)
+	return nil
+}
+
+// memberType returns the type of the member at host, derived from the StatefulSet running it
+func memberType(mongo *v1alpha1.MongoDB, host string) v1alpha1.MemberType {
+	pod := replicaset.PodName(host)
+	for component, memberType := range map[string]v1alpha1.MemberType{
+		util.ComponentArbiter: v1alpha1.MemberTypeArbiter,
+		util.ComponentHidden:  v1alpha1.MemberTypeHidden,
+		util.ComponentDelayed: v1alpha1.MemberTypeDelayed,
+	} {
+		if strings.HasPrefix(pod, util.MemberSetName(mongo, component)+"-") {
+			return memberType
+		}
+	}
+	return v1alpha1.MemberTypeData
+}
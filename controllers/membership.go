@@ -0,0 +1,318 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// membership changes the members of the replica sets generated by the reconcilers
+type membership struct {
+	client   client.Client
+	recorder record.EventRecorder
+	dial     replicaset.DialFunc
+
+	// reader reads the Nodes running the members
+	reader client.Reader
+}
+
+// reconcile makes the next change of the replica set membership towards the desired members of the
+// memberSets and sets the number of replicas of their StatefulSets.  New Pods are created first and added to the
+// replica set as non-voting members which are promoted once they caught up.  On scale down the members of the
+// highest ordinals are removed from the replica set first, stepping down the primary if it is one of them, and
+// the Pods are only removed afterwards.  sets[0] are the data members, configured by memberConfig.  requeue
+// is true while changes are in progress.  An error is only returned if the memberConfig is invalid.
+func (ms *membership) reconcile(ctx context.Context, log logr.Logger, obj runtime.Object, sets []*memberSet, memberConfig []v1alpha1.MemberConfigSpec) (requeue bool, err error) {
+	for _, set := range sets {
+		set.replicas = set.desired
+	}
+	data := sets[0]
+	if ms.dial == nil || !data.exists {
+		return false, nil
+	}
+
+	// Members are only removed from the StatefulSets once they have been removed from the replica set, so scale
+	// down is deferred while the replica set cannot be reached
+	deferred := func() bool {
+		requeue := false
+		for _, set := range sets {
+			if set.desired < set.current {
+				set.replicas = set.current
+				requeue = true
+			}
+		}
+		return requeue
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	log = log.WithValues("replicas", data.desired, "currentReplicas", data.current)
+
+	serviceHost := fmt.Sprintf("%s.%s.svc:27017", data.service.Name, data.service.Namespace)
+	c, err := ms.dial(ctx, []string{serviceHost})
+	if err != nil {
+		log.V(1).Info("unable to connect to replica set", "host", serviceHost, "error", err.Error())
+		return deferred(), nil
+	}
+	defer c.Close(ctx)
+	status, err := c.Status(ctx)
+	if err != nil {
+		log.V(1).Info("unable to get replica set status", "host", serviceHost, "error", err.Error())
+		return deferred(), nil
+	}
+	if !status.Initialized {
+		deferred()
+		data.replicas = ms.initiate(ctx, log, data)
+		return true, nil
+	}
+
+	var hosts []string
+	for _, set := range sets {
+		for i := int32(0); i < set.current; i++ {
+			hosts = append(hosts, memberHost(set.ss, set.service, i))
+		}
+	}
+	primary, err := ms.dial(ctx, hosts)
+	if err != nil {
+		log.V(1).Info("unable to connect to replica set primary", "error", err.Error())
+		return deferred(), nil
+	}
+	defer primary.Close(ctx)
+	config, err := primary.Config(ctx)
+	if err != nil {
+		log.V(1).Info("unable to get replica set config", "error", err.Error())
+		return deferred(), nil
+	}
+
+	// Pods of the StatefulSets scaled away are removed from the replica set, other members are left alone
+	remove := func(host string) bool {
+		for _, set := range sets {
+			if memberOrdinal(set.ss, host) >= 0 {
+				return true
+			}
+		}
+		return false
+	}
+	ready := func(host string) bool {
+		return !horizonPending(sets, host) && ms.podReady(ctx, data.ss.Namespace, replicaset.PodName(host))
+	}
+	want := wantedMembers(sets)
+	var zones []string
+	if len(memberConfig) > 0 {
+		zones = ms.zones(ctx, log, data)
+	}
+	if err := util.ApplyMemberConfig(want, int(data.desired), memberConfig, zones); err != nil {
+		deferred()
+		return false, err
+	}
+	change := replicaset.NextChange(config, status, want, ready, remove)
+	if change != nil {
+		ms.applyChange(ctx, log, obj, primary, change)
+	}
+
+	// Keep the Pods until their members have been removed
+	requeue = change != nil
+	for _, set := range sets {
+		for _, m := range config.Members {
+			if memberOrdinal(set.ss, m.Host) >= int(set.desired) {
+				set.replicas = set.current
+				requeue = true
+			}
+		}
+	}
+	return requeue, nil
+}
+
+// initiate initiates the replica set with the first data member once its Pod is ready.  The other members are
+// added by later reconciles.  It returns the number of replicas of the StatefulSet.
+func (ms *membership) initiate(ctx context.Context, log logr.Logger, data *memberSet) int32 {
+	replicas := int32(1)
+	if data.current > replicas {
+		replicas = data.current
+	}
+
+	host := memberHost(data.ss, data.service, 0)
+	if !ms.podReady(ctx, data.ss.Namespace, replicaset.PodName(host)) {
+		log.V(1).Info("waiting for the first member to initiate the replica set", "host", host)
+		return replicas
+	}
+	c, err := ms.dial(ctx, []string{host})
+	if err != nil {
+		log.V(1).Info("unable to connect to the first member", "host", host, "error", err.Error())
+		return replicas
+	}
+	defer c.Close(ctx)
+	config := &replicaset.Config{
+		ID:      data.replSetName,
+		Version: 1,
+		Members: []replicaset.MemberConfig{{ID: 0, Host: host, Priority: 1, Votes: 1}},
+	}
+	if data.configServer {
+		config.Extra = map[string]interface{}{"configsvr": true}
+	}
+	if err := c.Initiate(ctx, config); err != nil {
+		log.Error(err, "unable to initiate replica set", "host", host)
+		return replicas
+	}
+	log.Info("initiated replica set", "host", host)
+	return replicas
+}
+
+// validateMembers returns an error if the desired members of the sets, configured by memberConfig, do not have an
+// odd number of voting members or are otherwise invalid.  It does not need the replica set, so that invalid specs
+// are rejected before anything is changed.  Entries selecting members by zone are only validated by reconcile,
+// once the members are scheduled.
+func validateMembers(sets []*memberSet, memberConfig []v1alpha1.MemberConfigSpec) error {
+	return util.ApplyMemberConfig(wantedMembers(sets), int(sets[0].desired), memberConfig, nil)
+}
+
+// applyChange applies a single membership change.  Errors are logged and the change is retried by the
+// next reconcile.
+func (ms *membership) applyChange(ctx context.Context, log logr.Logger, obj runtime.Object, c replicaset.Client, change *replicaset.Change) {
+	log = log.WithValues("action", change.Action, "member", change.Member)
+	if change.Action == replicaset.ActionStepDown {
+		if err := c.StepDown(ctx); err != nil {
+			log.Error(err, "unable to step down primary")
+			return
+		}
+		log.Info("primary stepped down before its removal")
+		ms.recorder.Eventf(obj, corev1.EventTypeNormal, ReasonSteppedDown, "Primary %s stepped down before its removal", change.Member)
+		return
+	}
+
+	if err := c.Reconfig(ctx, change.Config); err != nil {
+		log.Error(err, "unable to reconfigure replica set", "version", change.Config.Version)
+		return
+	}
+	log.Info("reconfigured replica set", "version", change.Config.Version)
+	if change.Action == replicaset.ActionUpdate {
+		m := change.Config.Member(change.Member)
+		ms.recorder.Eventf(obj, corev1.EventTypeNormal, ReasonMemberPromoted,
+			"Member %s now has %d votes and priority %g", change.Member, m.Votes, m.Priority)
+	}
+}
+
+// wantedMembers returns the members running in the first desired Pods of the StatefulSets.  Data members vote
+// up to MaxVotingMembers including the voting members of the other sets, the others are non-voting.  Members
+// exposed outside the cluster have their external address as external horizon.
+func wantedMembers(sets []*memberSet) []replicaset.MemberConfig {
+	voting := int32(replicaset.MaxVotingMembers)
+	for _, set := range sets[1:] {
+		if set.member.Votes > 0 {
+			voting -= set.desired
+		}
+	}
+
+	var members []replicaset.MemberConfig
+	for _, set := range sets {
+		for i := int32(0); i < set.desired; i++ {
+			m := set.member
+			m.Host = memberHost(set.ss, set.service, i)
+			if set == sets[0] && i >= voting {
+				m.Votes = 0
+				m.Priority = 0
+			}
+			if int(i) < len(set.horizons) && set.horizons[i] != "" {
+				m.Horizons = map[string]string{replicaset.ExternalHorizon: set.horizons[i]}
+			}
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// horizonPending returns true if the member at host is exposed outside the cluster but its external address is
+// not assigned yet.  Such members are not added since all members must have the same horizons.
+func horizonPending(sets []*memberSet, host string) bool {
+	for _, set := range sets {
+		if i := memberOrdinal(set.ss, host); i >= 0 && i < len(set.horizons) {
+			return set.horizons[i] == ""
+		}
+	}
+	return false
+}
+
+// memberHost returns the host of the member running in the Pod with the given ordinal
+func memberHost(ss *appsv1.StatefulSet, service *corev1.Service, ordinal int32) string {
+	return fmt.Sprintf("%s-%d.%s.%s.svc:27017", ss.Name, ordinal, service.Name, ss.Namespace)
+}
+
+// memberOrdinal returns the ordinal of the Pod of the StatefulSet running the member at host, or -1 if the member
+// does not run in a Pod of the StatefulSet
+func memberOrdinal(ss *appsv1.StatefulSet, host string) int {
+	pod := replicaset.PodName(host)
+	if !strings.HasPrefix(pod, ss.Name+"-") {
+		return -1
+	}
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(pod, ss.Name+"-"))
+	if err != nil || ordinal < 0 {
+		return -1
+	}
+	return ordinal
+}
+
+// zones returns the zones of the nodes running the desired data members, indexed by ordinal.  The zone of
+// members which are not scheduled yet is "".
+func (ms *membership) zones(ctx context.Context, log logr.Logger, data *memberSet) []string {
+	zones := make([]string, data.desired)
+	for i := range zones {
+		pod := &corev1.Pod{}
+		name := fmt.Sprintf("%s-%d", data.ss.Name, i)
+		if err := ms.client.Get(ctx, types.NamespacedName{Namespace: data.ss.Namespace, Name: name}, pod); err != nil || pod.Spec.NodeName == "" {
+			continue
+		}
+		node := &corev1.Node{}
+		if err := ms.reader.Get(ctx, types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+			log.V(1).Info("unable to get zone of member", "pod", name, "node", pod.Spec.NodeName, "error", err.Error())
+			continue
+		}
+		zones[i] = node.Labels[util.ZoneLabel]
+		if zones[i] == "" {
+			zones[i] = node.Labels[util.ZoneLabelBeta]
+		}
+	}
+	return zones
+}
+
+// podReady returns true if the Pod exists and is ready
+func (ms *membership) podReady(ctx context.Context, namespace, name string) bool {
+	pod := &corev1.Pod{}
+	if err := ms.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, pod); err != nil {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
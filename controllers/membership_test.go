@@ -0,0 +1,312 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeReplicaSet is a replicaset.Client of a replica set with the given status and config, which records the
+// changes made to it
+type fakeReplicaSet struct {
+	status *replicaset.Status
+	config *replicaset.Config
+
+	initiated   *replicaset.Config
+	steppedDown bool
+}
+
+func (rs *fakeReplicaSet) Status(ctx context.Context) (*replicaset.Status, error) {
+	return rs.status, nil
+}
+
+func (rs *fakeReplicaSet) Config(ctx context.Context) (*replicaset.Config, error) {
+	return rs.config, nil
+}
+
+func (rs *fakeReplicaSet) Initiate(ctx context.Context, config *replicaset.Config) error {
+	rs.initiated = config
+	return nil
+}
+
+func (rs *fakeReplicaSet) Reconfig(ctx context.Context, config *replicaset.Config) error {
+	rs.config = config
+	return nil
+}
+
+func (rs *fakeReplicaSet) StepDown(ctx context.Context) error {
+	rs.steppedDown = true
+	return nil
+}
+
+func (rs *fakeReplicaSet) Shards(ctx context.Context) ([]replicaset.Shard, error) {
+	return nil, nil
+}
+
+func (rs *fakeReplicaSet) AddShard(ctx context.Context, shard string) error {
+	return nil
+}
+
+func (rs *fakeReplicaSet) Close(ctx context.Context) error {
+	return nil
+}
+
+// dial is a replicaset.DialFunc connecting to rs whatever the hosts
+func (rs *fakeReplicaSet) dial(ctx context.Context, hosts []string) (replicaset.Client, error) {
+	return rs, nil
+}
+
+// unreachable is a replicaset.DialFunc failing to connect
+func unreachable(ctx context.Context, hosts []string) (replicaset.Client, error) {
+	return nil, errors.New("no reachable servers")
+}
+
+// readyPod returns the ready Pod with the given name
+func readyPod(name string) runtime.Object {
+	return &corev1.Pod{
+		ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: "default"},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+		}},
+	}
+}
+
+// newSet returns the memberSet of the component of the MongoDB foo with desired and current members
+func newSet(memberType v1alpha1.MemberType, component string, member replicaset.MemberConfig, desired, current int32) *memberSet {
+	name := "foo-mongodb-" + component
+	return &memberSet{
+		memberType:  memberType,
+		component:   component,
+		replSetName: util.ReplicaSetName,
+		service:     &corev1.Service{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: "default"}},
+		ss:          &appsv1.StatefulSet{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: "default"}},
+		member:      member,
+		desired:     desired,
+		current:     current,
+		exists:      current > 0,
+	}
+}
+
+// dataSet returns the memberSet of the data members of the MongoDB foo
+func dataSet(desired, current int32) *memberSet {
+	return newSet(v1alpha1.MemberTypeData, util.ComponentReplicaSet, replicaset.MemberConfig{Votes: 1, Priority: 1}, desired, current)
+}
+
+var _ = Describe("validateMembers", func() {
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	It("should require an odd number of voting members without memberConfig", func() {
+		Expect(validateMembers([]*memberSet{dataSet(3, 0)}, nil)).To(Succeed())
+		Expect(validateMembers([]*memberSet{dataSet(4, 0)}, nil)).NotTo(Succeed())
+
+		arbiter := newSet(v1alpha1.MemberTypeArbiter, util.ComponentArbiter, replicaset.MemberConfig{ArbiterOnly: true, Votes: 1}, 1, 0)
+		Expect(validateMembers([]*memberSet{dataSet(4, 0), arbiter}, nil)).To(Succeed())
+	})
+
+	It("should apply the same rule with memberConfig", func() {
+		tags := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(0), Tags: map[string]string{"dc": "east"}}}
+		Expect(validateMembers([]*memberSet{dataSet(4, 0)}, tags)).NotTo(Succeed())
+		Expect(validateMembers([]*memberSet{dataSet(3, 0)}, tags)).To(Succeed())
+
+		nonVoting := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(3), Votes: int32Ptr(0), Priority: int32Ptr(0)}}
+		Expect(validateMembers([]*memberSet{dataSet(4, 0)}, nonVoting)).To(Succeed())
+	})
+
+	It("should only count up to the maximum voting members", func() {
+		Expect(validateMembers([]*memberSet{dataSet(8, 0)}, nil)).To(Succeed())
+	})
+
+	It("should leave members selected by zone to the reconcile", func() {
+		zone := []v1alpha1.MemberConfigSpec{{Zone: "east", Votes: int32Ptr(0), Priority: int32Ptr(0)}}
+		Expect(validateMembers([]*memberSet{dataSet(3, 0)}, zone)).To(Succeed())
+	})
+})
+
+var _ = Describe("membership", func() {
+	var ms *membership
+	var recorder *record.FakeRecorder
+	var rs *fakeReplicaSet
+	var mongo *v1alpha1.MongoDB
+
+	// member returns the host of the data member with the given ordinal
+	member := func(ordinal int32) string {
+		return memberHost(dataSet(0, 0).ss, dataSet(0, 0).service, ordinal)
+	}
+	// members returns the config of the data members with the given ordinals, which vote unless they are in
+	// nonVoting
+	members := func(ordinals []int32, nonVoting ...int32) []replicaset.MemberConfig {
+		var configs []replicaset.MemberConfig
+		for _, i := range ordinals {
+			m := replicaset.MemberConfig{ID: int(i), Host: member(i), Votes: 1, Priority: 1}
+			for _, j := range nonVoting {
+				if i == j {
+					m.Votes, m.Priority = 0, 0
+				}
+			}
+			configs = append(configs, m)
+		}
+		return configs
+	}
+	// statuses returns the status of the data members with the given ordinals, the first one being primary
+	statuses := func(ordinals ...int32) []replicaset.MemberStatus {
+		var status []replicaset.MemberStatus
+		for _, i := range ordinals {
+			state := replicaset.StateSecondary
+			if len(status) == 0 {
+				state = replicaset.StatePrimary
+			}
+			status = append(status, replicaset.MemberStatus{ID: int(i), Name: member(i), Health: 1, StateStr: state})
+		}
+		return status
+	}
+	reconcile := func(data *memberSet) bool {
+		requeue, err := ms.reconcile(context.Background(), ctrl.Log, mongo, []*memberSet{data}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return requeue
+	}
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		rs = &fakeReplicaSet{status: &replicaset.Status{Initialized: true, Set: util.ReplicaSetName}}
+		mongo = &v1alpha1.MongoDB{ObjectMeta: ctrl.ObjectMeta{Name: "foo", Namespace: "default"}}
+		ms = &membership{
+			client: fake.NewFakeClientWithScheme(newScheme(),
+				readyPod("foo-mongodb-replicaset-0"), readyPod("foo-mongodb-replicaset-1"), readyPod("foo-mongodb-replicaset-2")),
+			recorder: recorder,
+			dial:     rs.dial,
+		}
+	})
+
+	Context("initiate", func() {
+		BeforeEach(func() {
+			rs.status.Initialized = false
+		})
+
+		It("should initiate the replica set with the first member once it is ready", func() {
+			data := dataSet(3, 1)
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(1)))
+			Expect(rs.initiated).NotTo(BeNil())
+			Expect(rs.initiated.ID).To(Equal(util.ReplicaSetName))
+			Expect(rs.initiated.Members).To(Equal(members([]int32{0})))
+		})
+
+		It("should wait for the first member to be ready", func() {
+			ms.client = fake.NewFakeClientWithScheme(newScheme())
+			data := dataSet(3, 1)
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(1)))
+			Expect(rs.initiated).To(BeNil())
+		})
+	})
+
+	Context("on scale up", func() {
+		It("should add ready members as non-voting members", func() {
+			rs.config = &replicaset.Config{ID: util.ReplicaSetName, Version: 1, Members: members([]int32{0})}
+			rs.status.Members = statuses(0)
+
+			data := dataSet(3, 3)
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(3)))
+			Expect(rs.config.Version).To(Equal(2))
+			Expect(rs.config.Members).To(Equal(members([]int32{0, 1}, 1)))
+		})
+
+		It("should promote members once they caught up", func() {
+			rs.config = &replicaset.Config{ID: util.ReplicaSetName, Version: 3, Members: members([]int32{0, 1, 2}, 2)}
+			rs.status.Members = statuses(0, 1, 2)
+
+			Expect(reconcile(dataSet(3, 3))).To(BeTrue())
+			Expect(rs.config.Members).To(Equal(members([]int32{0, 1, 2})))
+			Expect(<-recorder.Events).To(ContainSubstring(ReasonMemberPromoted))
+		})
+
+		It("should leave the members alone once they match", func() {
+			rs.config = &replicaset.Config{ID: util.ReplicaSetName, Version: 3, Members: members([]int32{0, 1, 2})}
+			rs.status.Members = statuses(0, 1, 2)
+
+			Expect(reconcile(dataSet(3, 3))).To(BeFalse())
+			Expect(rs.config.Version).To(Equal(3))
+		})
+	})
+
+	Context("on scale down", func() {
+		BeforeEach(func() {
+			rs.config = &replicaset.Config{ID: util.ReplicaSetName, Version: 3, Members: members([]int32{0, 1, 2})}
+		})
+
+		It("should step down the primary before removing it", func() {
+			rs.status.Members = statuses(2, 0, 1)
+
+			data := dataSet(1, 3)
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(3)))
+			Expect(rs.steppedDown).To(BeTrue())
+			Expect(rs.config.Version).To(Equal(3))
+			Expect(<-recorder.Events).To(ContainSubstring(ReasonSteppedDown))
+		})
+
+		It("should remove the members of the highest ordinals before their Pods", func() {
+			rs.status.Members = statuses(0, 1, 2)
+
+			data := dataSet(1, 3)
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(3)))
+			Expect(rs.steppedDown).To(BeFalse())
+			Expect(rs.config.Members).To(Equal(members([]int32{0, 1})))
+
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(3)))
+			Expect(rs.config.Members).To(Equal(members([]int32{0})))
+
+			Expect(reconcile(data)).To(BeFalse())
+			Expect(data.replicas).To(Equal(int32(1)))
+		})
+	})
+
+	Context("with an unreachable replica set", func() {
+		BeforeEach(func() {
+			ms.dial = unreachable
+		})
+
+		It("should scale up without changing the members", func() {
+			data := dataSet(3, 1)
+			Expect(reconcile(data)).To(BeFalse())
+			Expect(data.replicas).To(Equal(int32(3)))
+		})
+
+		It("should defer scaling down", func() {
+			data := dataSet(1, 3)
+			Expect(reconcile(data)).To(BeTrue())
+			Expect(data.replicas).To(Equal(int32(3)))
+		})
+	})
+})
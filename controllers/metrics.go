@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// instancePhase is 1 for the current phase of each MongoDB and 0 for all other phases.
+	// Instances by phase are given by sum by (phase) (mongodb_operator_instance_phase).
+	instancePhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_operator_instance_phase",
+		Help: "Phase of each MongoDB managed by the operator",
+	}, []string{"namespace", "name", "phase"})
+
+	readyMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_operator_ready_members",
+		Help: "Number of ready members of each MongoDB",
+	}, []string{"namespace", "name"})
+
+	reconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_operator_reconcile_step_duration_seconds",
+		Help:    "Duration of each step of the MongoDB reconcile",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"step"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_operator_reconcile_errors_total",
+		Help: "Number of failed MongoDB reconciles by cause",
+	}, []string{"cause"})
+
+	upgrades = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_operator_upgrades_total",
+		Help: "Number of mongo image upgrades by result",
+	}, []string{"result"})
+
+	backups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_operator_backups_total",
+		Help: "Number of backups taken by the operator by result",
+	}, []string{"result"})
+
+	drifts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_operator_drifts_total",
+		Help: "Number of generated objects found changed by others by kind",
+	}, []string{"kind"})
+)
+
+// Causes of reconcile errors
+const (
+	causeFetch          = "fetch"
+	causeInvalidConfig  = "invalid_config"
+	causeService        = "service"
+	causeConfigMap      = "configmap"
+	causeReferences     = "references"
+	causeStatefulSet    = "statefulset"
+	causeServiceMonitor = "servicemonitor"
+	causeStatus         = "status"
+	causeFinalizer      = "finalizer"
+	causeFinalBackup    = "final_backup"
+	causeTermination    = "termination"
+	causeAdoption       = "adoption"
+	causeMigration      = "migration"
+	causeMemberSets     = "member_sets"
+	causeConfigServer   = "config_server"
+	causeShard          = "shard"
+	causeMongos         = "mongos"
+	causeShardRegistry  = "shard_registration"
+	causeExternalAccess = "external_access"
+	causeNetworkPolicy  = "networkpolicy"
+)
+
+// Results of upgrades and backups
+const (
+	resultStarted   = "started"
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+)
+
+func init() {
+	metrics.Registry.MustRegister(instancePhase, readyMembers, reconcileStepDuration, reconcileErrors, upgrades, backups, drifts)
+}
+
+// observeStep records the duration of a reconcile step started at start
+func observeStep(step string, start time.Time) {
+	reconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+}
+
+// recordInstanceMetrics records the per-instance metrics from the MongoDB status
+func recordInstanceMetrics(mongo *v1alpha1.MongoDB) {
+	for _, phase := range v1alpha1.MongoDBPhases {
+		v := 0.0
+		if mongo.Status.Phase == phase {
+			v = 1
+		}
+		instancePhase.WithLabelValues(mongo.Namespace, mongo.Name, string(phase)).Set(v)
+	}
+	readyMembers.WithLabelValues(mongo.Namespace, mongo.Name).Set(float64(mongo.Status.StatefulSetStatus.ReadyReplicas))
+}
+
+// deleteInstanceMetrics removes the per-instance metrics of a deleted MongoDB
+func deleteInstanceMetrics(namespace, name string) {
+	for _, phase := range v1alpha1.MongoDBPhases {
+		instancePhase.DeleteLabelValues(namespace, name, string(phase))
+	}
+	readyMembers.DeleteLabelValues(namespace, name)
+}
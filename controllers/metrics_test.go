@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("metrics", func() {
+	It("should record the phase and ready members of each instance", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "default"}}
+		mongo.Status.Phase = v1alpha1.PhaseProgressing
+		mongo.Status.StatefulSetStatus.ReadyReplicas = 2
+		recordInstanceMetrics(mongo)
+
+		for _, phase := range v1alpha1.MongoDBPhases {
+			want := 0.0
+			if phase == v1alpha1.PhaseProgressing {
+				want = 1
+			}
+			Expect(testutil.ToFloat64(instancePhase.WithLabelValues("default", "metrics", string(phase)))).To(Equal(want), string(phase))
+		}
+		Expect(testutil.ToFloat64(readyMembers.WithLabelValues("default", "metrics"))).To(Equal(2.0))
+
+		mongo.Status.Phase = v1alpha1.PhaseReady
+		recordInstanceMetrics(mongo)
+		Expect(testutil.ToFloat64(instancePhase.WithLabelValues("default", "metrics", string(v1alpha1.PhaseProgressing)))).To(BeZero())
+		Expect(testutil.ToFloat64(instancePhase.WithLabelValues("default", "metrics", string(v1alpha1.PhaseReady)))).To(Equal(1.0))
+	})
+
+	It("should delete the metrics of deleted instances", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "default"}}
+		recordInstanceMetrics(mongo)
+		deleteInstanceMetrics("default", "deleted")
+
+		Expect(readyMembers.DeleteLabelValues("default", "deleted")).To(BeFalse())
+		for _, phase := range v1alpha1.MongoDBPhases {
+			Expect(instancePhase.DeleteLabelValues("default", "deleted", string(phase))).To(BeFalse())
+		}
+	})
+
+	It("should observe the duration of reconcile steps", func() {
+		observeStep("test", time.Now().Add(-time.Second))
+
+		m := &dto.Metric{}
+		Expect(reconcileStepDuration.WithLabelValues("test").(prometheus.Histogram).Write(m)).To(Succeed())
+		Expect(m.GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+		Expect(m.GetHistogram().GetSampleSum()).To(BeNumerically(">=", 1))
+	})
+
+	It("should count succeeded upgrades", func() {
+		succeeded := testutil.ToFloat64(upgrades.WithLabelValues(resultSucceeded))
+		r := &MongoDBReconciler{Recorder: record.NewFakeRecorder(10)}
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		mongo.Status.CurrentImage = "mongo:4.0"
+		mongo.Status.SetCondition(v1alpha1.ConditionUpgrading, corev1.ConditionTrue, ReasonUpgradeStarted, "")
+		replicas := int32(1)
+		ss := &appsv1.StatefulSet{
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "mongo", Image: "mongo:4.2"}},
+				}},
+			},
+			Status: appsv1.StatefulSetStatus{UpdatedReplicas: 1},
+		}
+
+		r.setUpgradingCondition(mongo, ss)
+		Expect(testutil.ToFloat64(upgrades.WithLabelValues(resultSucceeded))).To(Equal(succeeded + 1))
+		r.setUpgradingCondition(mongo, ss)
+		Expect(testutil.ToFloat64(upgrades.WithLabelValues(resultSucceeded))).To(Equal(succeeded + 1))
+	})
+})
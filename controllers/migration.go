@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// migrationPollInterval is how often the deletion of an outdated StatefulSet is checked
+const migrationPollInterval = 5 * time.Second
+
+// migrateStatefulSet recreates a StatefulSet whose immutable selector does not match the generated one, e.g.
+// because it was created by an operator version using different labels.  The Pods are labeled with the new
+// selector and the StatefulSet is deleted orphaning them, so that the recreated StatefulSet adopts the running
+// Pods and rolls them one at a time.  Returns true while the old StatefulSet is being deleted.
+func (r *MongoDBReconciler) migrateStatefulSet(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, ss *appsv1.StatefulSet) (bool, error) {
+	existing := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: ss.Namespace, Name: ss.Name}, existing)
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if existing.DeletionTimestamp != nil {
+		log.V(1).Info("waiting for the old StatefulSet to be deleted", "name", existing.Name)
+		return true, nil
+	}
+
+	// Adopted StatefulSets keep their selector, and StatefulSets not controlled by the MongoDB are left alone
+	if mongo.Spec.Adopt != nil || !metav1.IsControlledBy(existing, mongo) {
+		return false, nil
+	}
+	selector := util.SelectorLabels(mongo, util.ComponentReplicaSet)
+	if existing.Spec.Selector != nil && len(existing.Spec.Selector.MatchExpressions) == 0 &&
+		reflect.DeepEqual(existing.Spec.Selector.MatchLabels, selector) {
+		return false, nil
+	}
+
+	oldSelector, err := metav1.LabelSelectorAsSelector(existing.Spec.Selector)
+	if err != nil {
+		return false, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods, client.UseListOptions(&client.ListOptions{
+		Namespace:     existing.Namespace,
+		LabelSelector: oldSelector,
+	})); err != nil {
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !metav1.IsControlledBy(pod, existing) {
+			continue
+		}
+		for k, v := range selector {
+			pod.Labels[k] = v
+		}
+		if err := r.Update(ctx, pod); err != nil {
+			return false, err
+		}
+	}
+
+	if err := r.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil && !apierrs.IsNotFound(err) {
+		return false, err
+	}
+	log.Info("recreating StatefulSet with the current selector", "name", existing.Name,
+		"oldSelector", oldSelector.String(), "pods", len(pods.Items))
+	r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonStatefulSetMigrated,
+		"Recreating StatefulSet %s with the current selector, its Pods keep running", existing.Name)
+	return true, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var _ = Describe("migrateStatefulSet", func() {
+	var mongo *v1alpha1.MongoDB
+	var existing *appsv1.StatefulSet
+	var c *deleteRecorder
+	var recorder *record.FakeRecorder
+	oldLabels := map[string]string{"app": "mongo"}
+
+	// migrate migrates the StatefulSet of the MongoDB with objs existing
+	migrate := func(objs ...runtime.Object) bool {
+		s := newScheme()
+		c = &deleteRecorder{Client: fake.NewFakeClientWithScheme(s, objs...)}
+		recorder = record.NewFakeRecorder(10)
+		r := &MongoDBReconciler{Client: c, Scheme: s, Log: ctrl.Log, Recorder: recorder}
+		ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: existing.Name, Namespace: existing.Namespace}}
+		deleting, err := r.migrateStatefulSet(context.Background(), r.Log, mongo, ss)
+		Expect(err).NotTo(HaveOccurred())
+		return deleting
+	}
+	// pod returns the Pod with the given name and the old labels, controlled by owner if it is not nil
+	pod := func(name string, owner metav1.Object) *corev1.Pod {
+		p := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{}}}
+		for k, v := range oldLabels {
+			p.Labels[k] = v
+		}
+		if owner != nil {
+			Expect(controllerutil.SetControllerReference(owner, p, newScheme())).To(Succeed())
+		}
+		return p
+	}
+	podLabels := func(name string) map[string]string {
+		p := &corev1.Pod{}
+		Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, p)).To(Succeed())
+		return p.Labels
+	}
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"}}
+		existing = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-statefulset", Namespace: "default", UID: "ss-uid"},
+			Spec:       appsv1.StatefulSetSpec{Selector: &metav1.LabelSelector{MatchLabels: oldLabels}},
+		}
+		Expect(controllerutil.SetControllerReference(mongo, existing, newScheme())).To(Succeed())
+	})
+
+	It("should do nothing without an existing StatefulSet", func() {
+		Expect(migrate()).To(BeFalse())
+		Expect(c.deleted).To(BeEmpty())
+	})
+
+	It("should keep a StatefulSet with the current selector", func() {
+		existing.Spec.Selector.MatchLabels = util.SelectorLabels(mongo, util.ComponentReplicaSet)
+		Expect(migrate(existing)).To(BeFalse())
+		Expect(c.deleted).To(BeEmpty())
+	})
+
+	It("should keep StatefulSets not controlled by the MongoDB", func() {
+		existing.OwnerReferences = nil
+		Expect(migrate(existing)).To(BeFalse())
+		Expect(c.deleted).To(BeEmpty())
+	})
+
+	It("should relabel the Pods and delete the StatefulSet orphaning them", func() {
+		Expect(migrate(existing, pod("foo-mongodb-statefulset-0", existing), pod("other", nil))).To(BeTrue())
+
+		selector := util.SelectorLabels(mongo, util.ComponentReplicaSet)
+		for k, v := range selector {
+			Expect(podLabels("foo-mongodb-statefulset-0")).To(HaveKeyWithValue(k, v))
+		}
+		Expect(podLabels("foo-mongodb-statefulset-0")).To(HaveKeyWithValue("app", "mongo"))
+		Expect(podLabels("other")).To(Equal(oldLabels))
+
+		Expect(c.deleted).To(Equal([]string{existing.Name}))
+		Expect(c.options[0].PropagationPolicy).NotTo(BeNil())
+		Expect(*c.options[0].PropagationPolicy).To(Equal(metav1.DeletePropagationOrphan))
+		Expect(<-recorder.Events).To(ContainSubstring(ReasonStatefulSetMigrated))
+	})
+
+	It("should wait for the outdated StatefulSet to be deleted", func() {
+		now := metav1.Now()
+		existing.DeletionTimestamp = &now
+		Expect(migrate(existing)).To(BeTrue())
+		Expect(c.deleted).To(BeEmpty())
+	})
+})
@@ -18,18 +18,31 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	"github.com/pwittrock/kubebuilder-workshop/requeue"
 	"github.com/pwittrock/kubebuilder-workshop/util"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // MongoDBReconciler reconciles a MongoDB object
@@ -38,87 +51,460 @@ type MongoDBReconciler struct {
 	Log      logr.Logger
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+
+	// Dial connects to the replica set members.  The replica set is not observed if Dial is nil.
+	Dial replicaset.DialFunc
+
+	// Selector selects the MongoDBs reconciled by this operator instance so that several instances can
+	// shard the MongoDBs between them.  All MongoDBs are reconciled if Selector is nil.
+	Selector labels.Selector
+
+	// Defaults is the operator configuration applied to the generated objects.  The compiled in defaults
+	// are used if Defaults is nil.
+	Defaults *operatorconfig.Watcher
+
+	// APIReader reads the Nodes running the members to match spec.memberConfig by zone, and the Secrets
+	// referenced by the Pods.  They are read uncached so that they are not watched in all namespaces, changes of
+	// the Secrets are noticed when the MongoDB is resynced.  The Client is used if APIReader is nil.
+	APIReader client.Reader
+
+	// Requeue decides when MongoDBs are reconciled again without an event.  The requeue.Default policy is used if
+	// Requeue is nil.
+	Requeue *requeue.Tracker
+
+	// serviceMonitors reads the watched ServiceMonitors from the cache, nil if they are not watched
+	serviceMonitors client.Reader
 }
 
 // +kubebuilder:rbac:groups=databases.example.com,resources=mongodbs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=databases.example.com,resources=mongodbs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
 
 func (r *MongoDBReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
-	log := r.Log.WithValues("mongodb", req.NamespacedName)
+	// reconcileID correlates all log lines of a single reconcile
+	log := r.Log.WithValues("mongodb", req.NamespacedName, "reconcileID", utilrand.String(8))
 
 	// Fetch the MongoDB instance
 	mongo := &v1alpha1.MongoDB{}
 	if err := r.Get(ctx, req.NamespacedName, mongo); err != nil {
-		log.Error(err, "unable to fetch MongoDB")
 		if apierrs.IsNotFound(err) {
+			// Owned objects are garbage collected
+			log.V(1).Info("MongoDB not found, assuming it was deleted")
+			deleteInstanceMetrics(req.Namespace, req.Name)
+			r.Requeue.Forget(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
-		return ctrl.Result{}, err
+		log.Error(err, "unable to fetch MongoDB")
+		reconcileErrors.WithLabelValues(causeFetch).Inc()
+		return r.Requeue.Failed(req.NamespacedName), nil
+	}
+	if !r.selects(mongo) {
+		log.V(1).Info("MongoDB not selected by the watch selector, skipping")
+		return ctrl.Result{}, nil
 	}
+	log = log.WithValues("generation", mongo.Generation, "resourceVersion", mongo.ResourceVersion)
+	log.V(1).Info("reconcile started")
+	defer func(start time.Time) {
+		log.V(1).Info("reconcile finished", "duration", time.Since(start).String())
+	}(time.Now())
 
-	// Generate Service
 	service := &corev1.Service{
 		ObjectMeta: ctrl.ObjectMeta{
 			Name:      req.Name + "-mongodb-service",
 			Namespace: req.Namespace,
 		},
 	}
-	_, err := ctrl.CreateOrUpdate(ctx, r.Client, service, func() error {
+	ss := &appsv1.StatefulSet{
+		ObjectMeta: ctrl.ObjectMeta{
+			Name:      req.Name + "-mongodb-statefulset",
+			Namespace: req.Namespace,
+		},
+	}
+
+	// Take over existing objects instead of generating new ones
+	if adopt := mongo.Spec.Adopt; adopt != nil {
+		service.Name = adopt.ServiceName
+		ss.Name = adopt.StatefulSetName
+	}
+
+	// Enforce the terminationPolicy before the generated objects are garbage collected
+	if !mongo.DeletionTimestamp.IsZero() {
+		return r.finalize(ctx, log, mongo, service, ss)
+	}
+	if err := r.addFinalizer(ctx, mongo); err != nil {
+		return r.failed(log, mongo, causeFinalizer, err)
+	}
+
+	// Skip all changes while paused, but keep the status up to date
+	if isPaused(mongo) {
+		log.Info("reconcile paused, skipping changes to generated objects")
+		r.setPausedCondition(mongo, true)
+		r.observeReplicaSet(ctx, log, mongo, service)
+		return r.requeue(ctx, log, mongo, service, ss, false)
+	}
+	r.setPausedCondition(mongo, false)
+
+	// Use the same defaults for all generated objects even if the configuration is reloaded meanwhile
+	defaults := r.defaults()
+
+	// Collect the changes made by others to the generated objects
+	drift := newDriftReport(mongo)
+
+	// Verify the StatefulSet referenced by spec.adopt can be taken over
+	adopted, err := r.adoptedStatefulSet(ctx, mongo)
+	if err != nil {
+		return r.failed(log, mongo, causeAdoption, err)
+	}
+
+	// Recreate a StatefulSet with an outdated selector before the Service selects the new Pod labels
+	migrating, err := r.migrateStatefulSet(ctx, log, mongo, ss)
+	if err != nil {
+		return r.failed(log, mongo, causeMigration, err)
+	}
+	if migrating {
+		return ctrl.Result{RequeueAfter: migrationPollInterval}, nil
+	}
+
+	// Generate Service
+	start := time.Now()
+	adoptingService := false
+	if adopted != nil {
+		existing := &corev1.Service{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: service.Namespace, Name: service.Name}, existing); err == nil {
+			adoptingService = metav1.GetControllerOf(existing) == nil
+		} else if !apierrs.IsNotFound(err) {
+			return r.failed(log, mongo, causeService, err)
+		}
+	}
+	op, err := apply(ctx, r.Client, r.Scheme, service, drift, func() error {
 		util.SetServiceFields(service, mongo)
+		util.SetServiceMonitoringFields(service, mongo.Spec.Monitoring)
+		util.SetDefaultMetadata(service, defaults)
+		if adopted != nil {
+			// Select the Pods by the immutable selector of the adopted StatefulSet so that both the adopted and
+			// the rolled Pods are selected
+			service.Spec.Selector = map[string]string{}
+			for k, v := range adopted.Spec.Selector.MatchLabels {
+				service.Spec.Selector[k] = v
+			}
+		}
 		return controllerutil.SetControllerReference(mongo, service, r.Scheme)
 	})
+	observeStep("service", start)
 	if err != nil {
-		return ctrl.Result{}, err
+		return r.failed(log, mongo, causeService, err)
+	}
+	r.recordOperation(log, mongo, op, "Service", service, ReasonServiceCreated, ReasonServiceUpdated)
+	if adoptingService && op == controllerutil.OperationResultUpdated {
+		r.recordAdoption(log, mongo, "Service", service)
 	}
 
-	// Generate StatefulSet
-	ss := &appsv1.StatefulSet{
+	// Generate ConfigMap
+	start = time.Now()
+	mongodConfig := util.MongodConfig
+	if mongo.Spec.IsStandalone() {
+		mongodConfig = util.StandaloneMongodConfig
+	}
+	config, err := mongodConfig(mongo.Spec.AdditionalMongodConfig)
+	if err != nil {
+		return r.failed(log, mongo, causeInvalidConfig, err)
+	}
+	if err := util.ValidateStandalone(&mongo.Spec); err != nil {
+		return r.failed(log, mongo, causeInvalidConfig, err)
+	}
+	sets, err := r.memberSets(ctx, mongo, service, ss, defaults)
+	if err != nil {
+		return r.failed(log, mongo, causeMemberSets, err)
+	}
+	if err := validateMembers(sets, mongo.Spec.MemberConfig); err != nil {
+		return r.failed(log, mongo, causeInvalidConfig, err)
+	}
+	configMap := &corev1.ConfigMap{
 		ObjectMeta: ctrl.ObjectMeta{
-			Name:      req.Name + "-mongodb-statefulset",
+			Name:      req.Name + "-mongodb-config",
 			Namespace: req.Namespace,
 		},
 	}
-	_, err = ctrl.CreateOrUpdate(ctx, r.Client, ss, func() error {
-		util.SetStatefulSetFields(ss, service, mongo, mongo.Spec.Replicas, mongo.Spec.Storage)
-		return controllerutil.SetControllerReference(mongo, ss, r.Scheme)
+	op, err = apply(ctx, r.Client, r.Scheme, configMap, drift, func() error {
+		util.SetConfigMapFields(configMap, mongo, config)
+		util.SetDefaultMetadata(configMap, defaults)
+		return controllerutil.SetControllerReference(mongo, configMap, r.Scheme)
+	})
+	observeStep("configmap", start)
+	if err != nil {
+		return r.failed(log, mongo, causeConfigMap, err)
+	}
+	r.recordOperation(log, mongo, op, "ConfigMap", configMap, ReasonConfigMapCreated, ReasonConfigMapUpdated)
 
+	// Hash the Secrets and ConfigMaps referenced by the Pods so that changes roll the members
+	referencesHash, err := r.referencesHash(ctx, mongo)
+	if err != nil {
+		return r.failed(log, mongo, causeReferences, err)
+	}
+
+	// Change the replica set membership before Pods are removed and after Pods are added
+	if err := r.reconcileExternalAccess(ctx, log, mongo, sets, defaults, drift); err != nil {
+		return r.failed(log, mongo, causeExternalAccess, err)
+	}
+	membersChanging := false
+	if mongo.Spec.IsStandalone() {
+		// There is no replica set to manage
+		for _, set := range sets {
+			set.replicas = set.desired
+		}
+	} else {
+		membersChanging, err = r.membership().reconcile(ctx, log, mongo, sets, mongo.Spec.MemberConfig)
+		if err != nil {
+			return r.failed(log, mongo, causeInvalidConfig, err)
+		}
+	}
+	replicas := sets[0].replicas
+
+	// Generate StatefulSet
+	restartedAt := mongo.Annotations[v1alpha1.RestartedAtAnnotation]
+	restartTriggered := false
+	previousImage := ""
+	var previousReplicas int32
+	adoptingStatefulSet := false
+	start = time.Now()
+	var live *appsv1.StatefulSet
+	existing := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: ss.Namespace, Name: ss.Name}, existing); err == nil {
+		live = existing
+		adoptingStatefulSet = adopted != nil && metav1.GetControllerOf(existing) == nil
+		restartTriggered = restartedAt != "" && existing.Spec.Template.Annotations[v1alpha1.RestartedAtAnnotation] != restartedAt
+		previousImage = util.ContainerImage(&existing.Spec.Template, "mongo")
+		if existing.Spec.Replicas != nil {
+			previousReplicas = *existing.Spec.Replicas
+		}
+	} else if !apierrs.IsNotFound(err) {
+		return r.failed(log, mongo, causeStatefulSet, err)
+	}
+	op, err = apply(ctx, r.Client, r.Scheme, ss, drift, func() error {
+		util.SetStatefulSetFields(ss, service, configMap, mongo, &replicas, mongo.Spec.Storage, defaults)
+		util.SetMonitoringFields(ss, mongo.Spec.Monitoring, defaults)
+		util.PinDefaultImages(ss, &ss.Spec.Template, existing.Annotations)
+		if err := util.MergeStatefulSetOverrides(ss, mongo.Spec.PodTemplate, mongo.Spec.StatefulSetOverrides); err != nil {
+			return err
+		}
+		if adopted != nil {
+			util.KeepAdoptedFields(ss, adopted)
+			if err := util.ValidateStatefulSet(ss); err != nil {
+				return fmt.Errorf("invalid StatefulSet after adoption: %v", err)
+			}
+		}
+		if err := checkImmutableFields(ss, live); err != nil {
+			return err
+		}
+		if referencesHash != "" {
+			ss.Spec.Template.Annotations[util.ReferencesHashAnnotation] = referencesHash
+		}
+		if restartedAt != "" {
+			ss.Spec.Template.Annotations[v1alpha1.RestartedAtAnnotation] = restartedAt
+		}
+		return controllerutil.SetControllerReference(mongo, ss, r.Scheme)
 	})
+	observeStep("statefulset", start)
+	upgradeTriggered := previousImage != "" && previousImage != util.ContainerImage(&ss.Spec.Template, "mongo")
+	if err != nil {
+		if upgradeTriggered {
+			upgrades.WithLabelValues(resultFailed).Inc()
+			r.Recorder.Eventf(mongo, corev1.EventTypeWarning, ReasonUpgradeFailed, "Failed to upgrade members from %s to %s: %v",
+				previousImage, util.ContainerImage(&ss.Spec.Template, "mongo"), err)
+		}
+		if _, ok := err.(invalidSpecError); ok {
+			return r.failed(log, mongo, causeInvalidConfig, err)
+		}
+		return r.failed(log, mongo, causeStatefulSet, err)
+	}
+	r.recordOperation(log, mongo, op, "StatefulSet", ss, ReasonStatefulSetCreated, ReasonStatefulSetUpdated)
+	if adoptingStatefulSet && op == controllerutil.OperationResultUpdated {
+		r.recordAdoption(log, mongo, "StatefulSet", ss)
+	}
+	if op == controllerutil.OperationResultUpdated && previousReplicas != *ss.Spec.Replicas {
+		r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonScaled, "Scaled from %d to %d members", previousReplicas, *ss.Spec.Replicas)
+	}
+	if upgradeTriggered && op == controllerutil.OperationResultUpdated {
+		log.Info("upgrade started", "image", util.ContainerImage(&ss.Spec.Template, "mongo"))
+		upgrades.WithLabelValues(resultStarted).Inc()
+		r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonUpgradeStarted, "Upgrading members from %s to %s",
+			previousImage, util.ContainerImage(&ss.Spec.Template, "mongo"))
+	}
+	if restartTriggered && op == controllerutil.OperationResultUpdated {
+		log.Info("rolling restart triggered", "restartedAt", restartedAt)
+		r.Recorder.Event(mongo, corev1.EventTypeNormal, ReasonRestartTriggered, "Rolling restart requested at "+restartedAt)
+	}
+
+	// Generate StatefulSets of arbiters, hidden and delayed members
+	if err := r.reconcileMemberSets(ctx, log, mongo, sets[1:], configMap, referencesHash, restartedAt, defaults, drift); err != nil {
+		if _, ok := err.(invalidSpecError); ok {
+			return r.failed(log, mongo, causeInvalidConfig, err)
+		}
+		return r.failed(log, mongo, causeMemberSets, err)
+	}
+
+	// Generate NetworkPolicy
+	if err := r.reconcileNetworkPolicy(ctx, log, mongo, defaults, drift); err != nil {
+		return r.failed(log, mongo, causeNetworkPolicy, err)
+	}
+
+	// Generate ServiceMonitor
+	start = time.Now()
+	err = r.reconcileServiceMonitor(ctx, log, mongo, service, defaults, drift)
+	observeStep("servicemonitor", start)
 	if err != nil {
-		return ctrl.Result{}, err
+		return r.failed(log, mongo, causeServiceMonitor, err)
 	}
 
-	// Update Status
-	ssNN := req.NamespacedName
-	ssNN.Name = ss.Name
-	if err := r.Get(ctx, ssNN, ss); err != nil {
+	r.setDriftCondition(mongo, drift)
+	r.observeReplicaSet(ctx, log, mongo, service)
+	return r.requeue(ctx, log, mongo, service, ss, membersChanging)
+}
+
+// membership returns the membership changing the members of the replica sets of the MongoDBs
+func (r *MongoDBReconciler) membership() *membership {
+	return &membership{client: r.Client, recorder: r.Recorder, dial: r.Dial, reader: r.apiReader()}
+}
+
+// apiReader returns the reader of the objects which are not cached
+func (r *MongoDBReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// selects returns true if the MongoDB is reconciled by this operator instance
+func (r *MongoDBReconciler) selects(mongo *v1alpha1.MongoDB) bool {
+	return r.Selector == nil || r.Selector.Matches(labels.Set(mongo.Labels))
+}
+
+// failed records a reconcile error caused by cause as a log line, a metric and an event.  Invalid specs are not
+// retried until the MongoDB or the operator configuration changes, other errors are retried with a backoff.  The
+// error is not returned since the rate limiter of the controller would retry it without jitter.
+func (r *MongoDBReconciler) failed(log logr.Logger, mongo *v1alpha1.MongoDB, cause string, err error) (ctrl.Result, error) {
+	log.Error(err, "reconcile failed", "step", cause)
+	reconcileErrors.WithLabelValues(cause).Inc()
+	reason := ReasonReconcileFailed
+	if cause == causeInvalidConfig {
+		reason = ReasonInvalidSpec
+	}
+	r.Recorder.Eventf(mongo, corev1.EventTypeWarning, reason, "Failed to reconcile %s: %v", cause, err)
+	if cause == causeInvalidConfig {
+		return ctrl.Result{}, nil
+	}
+	return r.Requeue.Failed(types.NamespacedName{Namespace: mongo.Namespace, Name: mongo.Name}), nil
+}
+
+// requeue updates the status and returns when the MongoDB is reconciled again: soon while it is not ready or its
+// members are changing, periodically once it is ready or paused, and with a backoff if the status update fails
+func (r *MongoDBReconciler) requeue(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, service *corev1.Service, ss *appsv1.StatefulSet, membersChanging bool) (ctrl.Result, error) {
+	key := types.NamespacedName{Namespace: mongo.Namespace, Name: mongo.Name}
+	if err := r.updateStatus(ctx, log, mongo, service, ss); err != nil {
+		return r.Requeue.Failed(key), nil
+	}
+	settled := mongo.Status.Phase == v1alpha1.PhaseReady || mongo.Status.Phase == v1alpha1.PhasePaused
+	return r.Requeue.Succeeded(key, settled && !membersChanging), nil
+}
+
+// recordOperation logs the result of reconciling a generated object, emitting an event if it was created or updated
+func (r *MongoDBReconciler) recordOperation(log logr.Logger, mongo *v1alpha1.MongoDB, op controllerutil.OperationResult, kind string, obj metav1.Object, createdReason, updatedReason string) {
+	recordOperation(r.Recorder, log, mongo, op, kind, obj, createdReason, updatedReason)
+}
+
+// recordOperation logs the result of reconciling an object generated for owner, emitting an event on owner if it
+// was created or updated
+func recordOperation(recorder record.EventRecorder, log logr.Logger, owner runtime.Object, op controllerutil.OperationResult, kind string, obj metav1.Object, createdReason, updatedReason string) {
+	log.V(1).Info("reconciled "+kind, "name", obj.GetName(), "operation", op, "resourceVersion", obj.GetResourceVersion())
+	switch op {
+	case controllerutil.OperationResultCreated:
+		log.Info("created "+kind, "name", obj.GetName())
+		recorder.Eventf(owner, corev1.EventTypeNormal, createdReason, "Created %s %s", kind, obj.GetName())
+	case controllerutil.OperationResultUpdated:
+		log.Info("updated "+kind, "name", obj.GetName())
+		recorder.Eventf(owner, corev1.EventTypeNormal, updatedReason, "Updated %s %s", kind, obj.GetName())
+	}
+}
+
+// updateStatus updates the MongoDB status from the generated objects.  Objects which do not exist yet,
+// e.g. because the reconcile is paused, are skipped.
+func (r *MongoDBReconciler) updateStatus(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, service *corev1.Service, ss *appsv1.StatefulSet) error {
+	defer observeStep("status", time.Now())
+
+	ssNN := types.NamespacedName{Namespace: ss.Namespace, Name: ss.Name}
+	ssFound := false
+	if err := r.Get(ctx, ssNN, ss); err == nil {
+		ssFound = true
+		mongo.Status.StatefulSetStatus = ss.Status
+		r.setRestartingCondition(mongo, ss)
+		r.setUpgradingCondition(mongo, ss)
+	} else if !apierrs.IsNotFound(err) {
 		log.Error(err, "unable to fetch StatefulSet", "namespaceName", ssNN)
-		return ctrl.Result{}, err
+		reconcileErrors.WithLabelValues(causeStatus).Inc()
+		return err
 	}
-	mongo.Status.StatefulSetStatus = ss.Status
 
-	serviceNN := req.NamespacedName
-	serviceNN.Name = service.Name
-	if err := r.Get(ctx, serviceNN, service); err != nil {
+	serviceNN := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if err := r.Get(ctx, serviceNN, service); err == nil {
+		mongo.Status.ServiceStatus = service.Status
+	} else if !apierrs.IsNotFound(err) {
 		log.Error(err, "unable to fetch Service", "namespaceName", serviceNN)
-		return ctrl.Result{}, err
+		reconcileErrors.WithLabelValues(causeStatus).Inc()
+		return err
 	}
-	mongo.Status.ServiceStatus = service.Status
 
-	err = r.Status().Update(ctx, mongo)
-	if err != nil {
-		return ctrl.Result{}, err
+	switch {
+	case isPaused(mongo):
+		mongo.Status.Phase = v1alpha1.PhasePaused
+	case !ssFound || ss.Status.ReadyReplicas == 0:
+		mongo.Status.Phase = v1alpha1.PhasePending
+	case isRollingOut(ss) || ss.Status.ReadyReplicas < ss.Status.Replicas:
+		mongo.Status.Phase = v1alpha1.PhaseProgressing
+	default:
+		mongo.Status.Phase = v1alpha1.PhaseReady
 	}
+	recordInstanceMetrics(mongo)
 
-	return ctrl.Result{}, nil
+	if err := r.Status().Update(ctx, mongo); err != nil {
+		log.Error(err, "unable to update MongoDB status")
+		reconcileErrors.WithLabelValues(causeStatus).Inc()
+		return err
+	}
+	log.V(1).Info("updated status", "phase", mongo.Status.Phase, "readyReplicas", mongo.Status.StatefulSetStatus.ReadyReplicas)
+	return nil
 }
 
 func (r *MongoDBReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if r.Requeue == nil {
+		r.Requeue = requeue.NewTracker(requeue.Default())
+	}
+	referencing := &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.referencingMongoDBs)}
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.MongoDB{}).
-		Owns(&appsv1.StatefulSet{}). // Generates StatefulSets
-		Owns(&corev1.Service{}).     // Generates Services
-		Complete(r)
+		Owns(&appsv1.StatefulSet{}).                                  // Generates StatefulSets
+		Owns(&corev1.Service{}).                                      // Generates Services
+		Owns(&corev1.ConfigMap{}).                                    // Generates ConfigMaps
+		Owns(&batchv1.Job{}).                                         // Generates final backup Jobs
+		Owns(&networkingv1.NetworkPolicy{}).                          // Generates NetworkPolicies
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, referencing) // Restarts members when referenced ConfigMaps change
+	if r.Defaults != nil {
+		// Applies reloaded operator configuration
+		builder = builder.Watches(r.defaultsChanged(), &handler.EnqueueRequestForObject{})
+	}
+	builder, err := r.watchServiceMonitors(mgr, builder) // Generates ServiceMonitors
+	if err != nil {
+		return err
+	}
+	return builder.Complete(r)
 }
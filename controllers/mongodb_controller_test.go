@@ -0,0 +1,48 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("selects", func() {
+	mongo := func(l map[string]string) *v1alpha1.MongoDB {
+		return &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Labels: l}}
+	}
+
+	It("should select all MongoDBs without a selector", func() {
+		r := &MongoDBReconciler{}
+		Expect(r.selects(mongo(nil))).To(BeTrue())
+		Expect(r.selects(mongo(map[string]string{"shard": "a"}))).To(BeTrue())
+	})
+
+	It("should select the MongoDBs matching the selector", func() {
+		selector, err := labels.Parse("shard in (a, b)")
+		Expect(err).NotTo(HaveOccurred())
+		r := &MongoDBReconciler{Selector: selector}
+
+		Expect(r.selects(mongo(map[string]string{"shard": "a"}))).To(BeTrue())
+		Expect(r.selects(mongo(map[string]string{"shard": "c"}))).To(BeFalse())
+		Expect(r.selects(mongo(nil))).To(BeFalse())
+	})
+})
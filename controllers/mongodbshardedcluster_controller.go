@@ -0,0 +1,422 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	"github.com/pwittrock/kubebuilder-workshop/requeue"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Roles of the replica sets of a sharded cluster
+const (
+	clusterRoleConfigServer = "configsvr"
+	clusterRoleShard        = "shardsvr"
+)
+
+// MongoDBShardedClusterReconciler reconciles a MongoDBShardedCluster object
+type MongoDBShardedClusterReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+
+	// Dial connects to the replica set members and mongos.  The replica sets are not initiated and the
+	// shards are not registered if Dial is nil.
+	Dial replicaset.DialFunc
+
+	// Selector selects the MongoDBShardedClusters reconciled by this operator instance.  All
+	// MongoDBShardedClusters are reconciled if Selector is nil.
+	Selector labels.Selector
+
+	// Defaults is the operator configuration applied to the generated objects.  The compiled in defaults
+	// are used if Defaults is nil.
+	Defaults *operatorconfig.Watcher
+
+	// Requeue decides when MongoDBShardedClusters are reconciled again without an event.  The requeue.Default
+	// policy is used if Requeue is nil.
+	Requeue *requeue.Tracker
+}
+
+// +kubebuilder:rbac:groups=databases.example.com,resources=mongodbshardedclusters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=databases.example.com,resources=mongodbshardedclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+
+func (r *MongoDBShardedClusterReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	// reconcileID correlates all log lines of a single reconcile
+	log := r.Log.WithValues("mongodbshardedcluster", req.NamespacedName, "reconcileID", utilrand.String(8))
+
+	// Fetch the MongoDBShardedCluster instance
+	cluster := &v1alpha1.MongoDBShardedCluster{}
+	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if apierrs.IsNotFound(err) {
+			// Owned objects are garbage collected
+			log.V(1).Info("MongoDBShardedCluster not found, assuming it was deleted")
+			r.Requeue.Forget(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "unable to fetch MongoDBShardedCluster")
+		reconcileErrors.WithLabelValues(causeFetch).Inc()
+		return r.Requeue.Failed(req.NamespacedName), nil
+	}
+	if !r.selects(cluster) {
+		log.V(1).Info("MongoDBShardedCluster not selected by the watch selector, skipping")
+		return ctrl.Result{}, nil
+	}
+	log = log.WithValues("generation", cluster.Generation, "resourceVersion", cluster.ResourceVersion)
+	log.V(1).Info("reconcile started")
+	defer func(start time.Time) {
+		log.V(1).Info("reconcile finished", "duration", time.Since(start).String())
+	}(time.Now())
+
+	// Use the same defaults for all generated objects even if the configuration is reloaded meanwhile
+	defaults := currentDefaults(r.Defaults)
+
+	// Reject replica sets without an odd number of voting members before anything is changed
+	configServer := r.replicaSet(cluster, util.ComponentConfigServer, cluster.Spec.ConfigServer, defaults)
+	configServer.configServer = true
+	if err := validateMembers([]*memberSet{configServer}, nil); err != nil {
+		return r.failed(log, cluster, causeInvalidConfig, fmt.Errorf("configServer: %v", err))
+	}
+	if err := validateMembers([]*memberSet{r.replicaSet(cluster, util.ShardComponent(0), cluster.Spec.Shard, defaults)}, nil); err != nil {
+		return r.failed(log, cluster, causeInvalidConfig, fmt.Errorf("shard: %v", err))
+	}
+
+	// Generate the config server replica set
+	requeue, err := r.reconcileReplicaSet(ctx, log, cluster, configServer, clusterRoleConfigServer, defaults)
+	if err != nil {
+		return r.failed(log, cluster, causeConfigServer, err)
+	}
+
+	// Generate the shard replica sets.  Registered shards are kept since removing them requires draining.
+	shards := int(cluster.Spec.Shards)
+	if kept := registeredShards(cluster); kept > shards {
+		log.Info("keeping shards removed from the spec", "shards", shards, "registeredShards", kept)
+		r.Recorder.Eventf(cluster, corev1.EventTypeWarning, ReasonShardRemovalUnsupported,
+			"Removing shards is not supported, keeping %d shards", kept)
+		shards = kept
+	}
+	var shardSets []*memberSet
+	for i := 0; i < shards; i++ {
+		set := r.replicaSet(cluster, util.ShardComponent(i), cluster.Spec.Shard, defaults)
+		changing, err := r.reconcileReplicaSet(ctx, log.WithValues("shard", set.replSetName), cluster, set, clusterRoleShard, defaults)
+		if err != nil {
+			return r.failed(log, cluster, causeShard, err)
+		}
+		requeue = requeue || changing
+		shardSets = append(shardSets, set)
+	}
+
+	// Generate the mongos Service and Deployment
+	var configHosts []string
+	for i := int32(0); i < configServer.desired; i++ {
+		configHosts = append(configHosts, memberHost(configServer.ss, configServer.service, i))
+	}
+	mongosService := &corev1.Service{
+		ObjectMeta: ctrl.ObjectMeta{Name: util.MemberSetName(cluster, util.ComponentMongos), Namespace: cluster.Namespace},
+	}
+	start := time.Now()
+	op, err := apply(ctx, r.Client, r.Scheme, mongosService, nil, func() error {
+		util.SetMongosServiceFields(mongosService, cluster)
+		util.SetDefaultMetadata(mongosService, defaults)
+		return controllerutil.SetControllerReference(cluster, mongosService, r.Scheme)
+	})
+	observeStep("service", start)
+	if err != nil {
+		return r.failed(log, cluster, causeMongos, err)
+	}
+	recordOperation(r.Recorder, log, cluster, op, "Service", mongosService, ReasonServiceCreated, ReasonServiceUpdated)
+
+	mongos := &appsv1.Deployment{
+		ObjectMeta: ctrl.ObjectMeta{Name: util.MemberSetName(cluster, util.ComponentMongos), Namespace: cluster.Namespace},
+	}
+	existing := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: mongos.Namespace, Name: mongos.Name}, existing); err != nil && !apierrs.IsNotFound(err) {
+		return r.failed(log, cluster, causeMongos, err)
+	}
+	start = time.Now()
+	op, err = apply(ctx, r.Client, r.Scheme, mongos, nil, func() error {
+		replicas := int32(1)
+		if cluster.Spec.Mongos.Replicas != nil {
+			replicas = *cluster.Spec.Mongos.Replicas
+		}
+		util.SetMongosDeploymentFields(mongos, cluster, replicaset.ConnectionString(configServer.replSetName, configHosts), &replicas, defaults)
+		util.PinDefaultImages(mongos, &mongos.Spec.Template, existing.Annotations)
+		return controllerutil.SetControllerReference(cluster, mongos, r.Scheme)
+	})
+	observeStep("deployment", start)
+	if err != nil {
+		return r.failed(log, cluster, causeMongos, err)
+	}
+	recordOperation(r.Recorder, log, cluster, op, "Deployment", mongos, ReasonDeploymentCreated, ReasonDeploymentUpdated)
+
+	// Register the shards once mongos is ready
+	registered := map[string]bool{}
+	if mongos.Status.ReadyReplicas > 0 {
+		registered = r.registerShards(ctx, log, cluster, mongosService, shardSets)
+	}
+
+	cluster.Status.ConfigServer = v1alpha1.ComponentStatus{
+		Replicas:      configServer.ss.Status.Replicas,
+		ReadyReplicas: configServer.ss.Status.ReadyReplicas,
+	}
+	cluster.Status.Mongos = v1alpha1.ComponentStatus{
+		Replicas:      mongos.Status.Replicas,
+		ReadyReplicas: mongos.Status.ReadyReplicas,
+	}
+	ready := configServer.ss.Status.ReadyReplicas == configServer.desired && mongos.Status.ReadyReplicas == mongos.Status.Replicas
+	cluster.Status.Shards = nil
+	for _, set := range shardSets {
+		cluster.Status.Shards = append(cluster.Status.Shards, v1alpha1.ShardStatus{
+			ComponentStatus: v1alpha1.ComponentStatus{
+				Replicas:      set.ss.Status.Replicas,
+				ReadyReplicas: set.ss.Status.ReadyReplicas,
+			},
+			Name:       set.replSetName,
+			Registered: registered[set.replSetName],
+		})
+		ready = ready && set.ss.Status.ReadyReplicas == set.desired && registered[set.replSetName]
+	}
+	switch {
+	case mongos.Status.ReadyReplicas == 0:
+		cluster.Status.Phase = v1alpha1.PhasePending
+	case !ready:
+		cluster.Status.Phase = v1alpha1.PhaseProgressing
+	default:
+		cluster.Status.Phase = v1alpha1.PhaseReady
+	}
+	if err := r.Status().Update(ctx, cluster); err != nil {
+		log.Error(err, "unable to update MongoDBShardedCluster status")
+		reconcileErrors.WithLabelValues(causeStatus).Inc()
+		return r.Requeue.Failed(req.NamespacedName), nil
+	}
+	log.V(1).Info("updated status", "phase", cluster.Status.Phase)
+
+	return r.Requeue.Succeeded(req.NamespacedName, !requeue && cluster.Status.Phase == v1alpha1.PhaseReady), nil
+}
+
+// replicaSet returns the memberSet of the replica set of the component, which is also the name of the replica set
+func (r *MongoDBShardedClusterReconciler) replicaSet(cluster *v1alpha1.MongoDBShardedCluster, component string, spec v1alpha1.ReplicaSetSpec, defaults *operatorconfig.Config) *memberSet {
+	name := util.MemberSetName(cluster, component)
+	set := &memberSet{
+		memberType:  v1alpha1.MemberTypeData,
+		component:   component,
+		replSetName: component,
+		service:     &corev1.Service{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: cluster.Namespace}},
+		ss:          &appsv1.StatefulSet{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: cluster.Namespace}},
+		storage:     spec.Storage,
+		member:      replicaset.MemberConfig{Votes: 1, Priority: 1},
+		desired:     defaults.Replicas,
+	}
+	if spec.Replicas != nil {
+		set.desired = *spec.Replicas
+	}
+	return set
+}
+
+// reconcileReplicaSet generates the ConfigMap, Service and StatefulSet of a replica set of the sharded cluster and
+// changes its members.  requeue is true while membership changes are in progress.
+func (r *MongoDBShardedClusterReconciler) reconcileReplicaSet(ctx context.Context, log logr.Logger, cluster *v1alpha1.MongoDBShardedCluster, set *memberSet, clusterRole string, defaults *operatorconfig.Config) (requeue bool, err error) {
+	config, err := util.ReplicaSetMongodConfig(set.replSetName, clusterRole, nil)
+	if err != nil {
+		return false, err
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: ctrl.ObjectMeta{Name: set.ss.Name + "-config", Namespace: cluster.Namespace},
+	}
+	start := time.Now()
+	op, err := apply(ctx, r.Client, r.Scheme, configMap, nil, func() error {
+		util.SetComponentConfigMapFields(configMap, cluster, set.component, config)
+		util.SetDefaultMetadata(configMap, defaults)
+		return controllerutil.SetControllerReference(cluster, configMap, r.Scheme)
+	})
+	observeStep("configmap", start)
+	if err != nil {
+		return false, err
+	}
+	recordOperation(r.Recorder, log, cluster, op, "ConfigMap", configMap, ReasonConfigMapCreated, ReasonConfigMapUpdated)
+
+	start = time.Now()
+	op, err = apply(ctx, r.Client, r.Scheme, set.service, nil, func() error {
+		util.SetMemberServiceFields(set.service, cluster, set.component)
+		util.SetDefaultMetadata(set.service, defaults)
+		return controllerutil.SetControllerReference(cluster, set.service, r.Scheme)
+	})
+	observeStep("service", start)
+	if err != nil {
+		return false, err
+	}
+	recordOperation(r.Recorder, log, cluster, op, "Service", set.service, ReasonServiceCreated, ReasonServiceUpdated)
+
+	// Change the replica set membership before Pods are removed and after Pods are added
+	if err := loadMemberSets(ctx, r, []*memberSet{set}); err != nil {
+		return false, err
+	}
+	m := &membership{client: r.Client, recorder: r.Recorder, dial: r.Dial, reader: r.Client}
+	requeue, err = m.reconcile(ctx, log, cluster, []*memberSet{set}, nil)
+	if err != nil {
+		return false, err
+	}
+
+	start = time.Now()
+	op, err = apply(ctx, r.Client, r.Scheme, set.ss, nil, func() error {
+		replicas := set.replicas
+		util.SetMemberStatefulSetFields(set.ss, set.service, configMap, cluster, set.component, &replicas, set.storage, defaults)
+		util.PinDefaultImages(set.ss, &set.ss.Spec.Template, set.liveAnnotations())
+		if err := checkImmutableFields(set.ss, set.live); err != nil {
+			return err
+		}
+		return controllerutil.SetControllerReference(cluster, set.ss, r.Scheme)
+	})
+	observeStep("statefulset", start)
+	if err != nil {
+		return false, err
+	}
+	recordOperation(r.Recorder, log, cluster, op, "StatefulSet", set.ss, ReasonStatefulSetCreated, ReasonStatefulSetUpdated)
+	return requeue, nil
+}
+
+// registerShards adds the shards which are not registered yet through mongos and returns the names of the
+// registered shards.  Errors are only logged since shards cannot be added before their replica set is initiated.
+func (r *MongoDBShardedClusterReconciler) registerShards(ctx context.Context, log logr.Logger, cluster *v1alpha1.MongoDBShardedCluster, service *corev1.Service, shards []*memberSet) map[string]bool {
+	registered := map[string]bool{}
+	if r.Dial == nil {
+		return registered
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	host := fmt.Sprintf("%s.%s.svc:27017", service.Name, service.Namespace)
+	c, err := r.Dial(ctx, []string{host})
+	if err != nil {
+		log.V(1).Info("unable to connect to mongos", "host", host, "error", err.Error())
+		return registered
+	}
+	defer c.Close(ctx)
+	existing, err := c.Shards(ctx)
+	if err != nil {
+		log.V(1).Info("unable to list shards", "host", host, "error", err.Error())
+		return registered
+	}
+	for _, shard := range existing {
+		registered[shard.ID] = true
+	}
+
+	for _, set := range shards {
+		if registered[set.replSetName] || set.current == 0 {
+			continue
+		}
+		var hosts []string
+		for i := int32(0); i < set.current; i++ {
+			hosts = append(hosts, memberHost(set.ss, set.service, i))
+		}
+		if err := c.AddShard(ctx, replicaset.ConnectionString(set.replSetName, hosts)); err != nil {
+			log.V(1).Info("unable to add shard", "shard", set.replSetName, "error", err.Error())
+			reconcileErrors.WithLabelValues(causeShardRegistry).Inc()
+			continue
+		}
+		registered[set.replSetName] = true
+		log.Info("added shard", "shard", set.replSetName)
+		r.Recorder.Eventf(cluster, corev1.EventTypeNormal, ReasonShardAdded, "Added shard %s", set.replSetName)
+	}
+	return registered
+}
+
+// registeredShards returns the number of shards up to the last registered shard in the status
+func registeredShards(cluster *v1alpha1.MongoDBShardedCluster) int {
+	n := 0
+	for i, shard := range cluster.Status.Shards {
+		if shard.Registered {
+			n = i + 1
+		}
+	}
+	return n
+}
+
+// selects returns true if the MongoDBShardedCluster is reconciled by this operator instance
+func (r *MongoDBShardedClusterReconciler) selects(cluster *v1alpha1.MongoDBShardedCluster) bool {
+	return r.Selector == nil || r.Selector.Matches(labels.Set(cluster.Labels))
+}
+
+// failed records a reconcile error caused by cause as a log line, a metric and an event, and retries the reconcile
+// with a backoff
+func (r *MongoDBShardedClusterReconciler) failed(log logr.Logger, cluster *v1alpha1.MongoDBShardedCluster, cause string, err error) (ctrl.Result, error) {
+	log.Error(err, "reconcile failed", "step", cause)
+	reconcileErrors.WithLabelValues(cause).Inc()
+	r.Recorder.Eventf(cluster, corev1.EventTypeWarning, ReasonReconcileFailed, "Failed to reconcile %s: %v", cause, err)
+	return r.Requeue.Failed(types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}), nil
+}
+
+func (r *MongoDBShardedClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Requeue == nil {
+		r.Requeue = requeue.NewTracker(requeue.Default())
+	}
+	builder := ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.MongoDBShardedCluster{}).
+		Owns(&appsv1.StatefulSet{}). // Generates the StatefulSets of the replica sets
+		Owns(&appsv1.Deployment{}).  // Generates the mongos Deployment
+		Owns(&corev1.Service{}).     // Generates Services
+		Owns(&corev1.ConfigMap{})    // Generates ConfigMaps
+	if r.Defaults != nil {
+		// Applies reloaded operator configuration
+		builder = builder.Watches(r.defaultsChanged(), &handler.EnqueueRequestForObject{})
+	}
+	return builder.Complete(r)
+}
+
+// defaultsChanged returns a source that triggers a reconcile of every selected MongoDBShardedCluster when the
+// operator configuration is reloaded
+func (r *MongoDBShardedClusterReconciler) defaultsChanged() source.Source {
+	events := make(chan event.GenericEvent)
+	r.Defaults.OnChange(func() {
+		list := &v1alpha1.MongoDBShardedClusterList{}
+		if err := r.List(context.Background(), list); err != nil {
+			r.Log.Error(err, "unable to list MongoDBShardedClusters after the operator configuration changed")
+			return
+		}
+		for i := range list.Items {
+			cluster := &list.Items[i]
+			if r.selects(cluster) {
+				events <- event.GenericEvent{Meta: cluster, Object: cluster}
+			}
+		}
+	})
+	return &source.Channel{Source: events}
+}
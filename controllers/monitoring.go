@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileServiceMonitor creates or updates the ServiceMonitor for the MongoDB, or deletes the ServiceMonitor owned
+// by the MongoDB if it is no longer enabled.  Nothing is done if the Prometheus Operator CRDs are not installed.
+func (r *MongoDBReconciler) reconcileServiceMonitor(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, service *corev1.Service, defaults *operatorconfig.Config, drift *driftReport) error {
+
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(util.ServiceMonitorGVK)
+	sm.SetName(mongo.Name + "-mongodb-servicemonitor")
+	sm.SetNamespace(mongo.Namespace)
+
+	if !util.ServiceMonitorEnabled(mongo.Spec.Monitoring) {
+		err := r.serviceMonitorReader().Get(ctx, types.NamespacedName{Namespace: sm.GetNamespace(), Name: sm.GetName()}, sm)
+		if apierrs.IsNotFound(err) || meta.IsNoMatchError(err) || (err == nil && !metav1.IsControlledBy(sm, mongo)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = r.Delete(ctx, sm)
+		if apierrs.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	_, err := apply(ctx, r.Client, r.Scheme, sm, drift, func() error {
+		if err := util.SetServiceMonitorFields(sm, service, mongo, mongo.Spec.Monitoring); err != nil {
+			return err
+		}
+		util.SetDefaultMetadata(sm, defaults)
+		return controllerutil.SetControllerReference(mongo, sm, r.Scheme)
+	})
+	if meta.IsNoMatchError(err) {
+		log.Info("ServiceMonitor CRD is not installed, skipping ServiceMonitor")
+		return nil
+	}
+	return err
+}
+
+// serviceMonitorReader returns the reader of the ServiceMonitors.  They are read from the cache if they are watched,
+// otherwise from the API server since the client does not cache unstructured objects.
+func (r *MongoDBReconciler) serviceMonitorReader() client.Reader {
+	if r.serviceMonitors != nil {
+		return r.serviceMonitors
+	}
+	return r.Client
+}
+
+// watchServiceMonitors watches the ServiceMonitors generated for the MongoDBs if the Prometheus Operator CRDs are
+// installed when the manager starts
+func (r *MongoDBReconciler) watchServiceMonitors(mgr ctrl.Manager, builder *ctrl.Builder) (*ctrl.Builder, error) {
+	_, err := mgr.GetRESTMapper().RESTMapping(util.ServiceMonitorGVK.GroupKind(), util.ServiceMonitorGVK.Version)
+	if meta.IsNoMatchError(err) {
+		r.Log.Info("ServiceMonitor CRD is not installed, not watching ServiceMonitors")
+		return builder, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sm := &unstructured.Unstructured{}
+	sm.SetGroupVersionKind(util.ServiceMonitorGVK)
+	r.serviceMonitors = mgr.GetCache()
+	return builder.Owns(sm), nil
+}
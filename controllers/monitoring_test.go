@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var _ = Describe("reconcileServiceMonitor", func() {
+	var mongo *v1alpha1.MongoDB
+	var c *deleteRecorder
+	key := types.NamespacedName{Namespace: "default", Name: "foo-mongodb-servicemonitor"}
+
+	// reconcile reconciles the ServiceMonitor of the MongoDB without monitoring with objs existing
+	reconcile := func(objs ...runtime.Object) error {
+		s := newScheme()
+		c = &deleteRecorder{Client: fake.NewFakeClientWithScheme(s, objs...)}
+		r := &MongoDBReconciler{Client: c, Scheme: s, Log: ctrl.Log, Recorder: record.NewFakeRecorder(10)}
+		return r.reconcileServiceMonitor(context.Background(), r.Log, mongo, &corev1.Service{}, operatorconfig.Default(), nil)
+	}
+	serviceMonitor := func() *unstructured.Unstructured {
+		sm := &unstructured.Unstructured{}
+		sm.SetGroupVersionKind(util.ServiceMonitorGVK)
+		sm.SetName(key.Name)
+		sm.SetNamespace(key.Namespace)
+		return sm
+	}
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"}}
+	})
+
+	It("should not delete a missing ServiceMonitor", func() {
+		Expect(reconcile()).To(Succeed())
+		Expect(c.deleted).To(BeEmpty())
+	})
+
+	It("should delete the ServiceMonitor of the MongoDB once monitoring is disabled", func() {
+		sm := serviceMonitor()
+		Expect(controllerutil.SetControllerReference(mongo, sm, newScheme())).To(Succeed())
+		Expect(reconcile(sm)).To(Succeed())
+
+		Expect(c.deleted).To(Equal([]string{key.Name}))
+		Expect(apierrs.IsNotFound(c.Get(context.Background(), key, serviceMonitor()))).To(BeTrue())
+	})
+
+	It("should keep a ServiceMonitor not owned by the MongoDB", func() {
+		Expect(reconcile(serviceMonitor())).To(Succeed())
+
+		Expect(c.deleted).To(BeEmpty())
+		Expect(c.Get(context.Background(), key, serviceMonitor())).To(Succeed())
+	})
+})
@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileNetworkPolicy creates or updates the NetworkPolicy of the members, or deletes the NetworkPolicy owned by
+// the MongoDB once spec.networkPolicy is removed
+func (r *MongoDBReconciler) reconcileNetworkPolicy(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, defaults *operatorconfig.Config, drift *driftReport) error {
+	defer observeStep("networkpolicy", time.Now())
+
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: ctrl.ObjectMeta{Name: mongo.Name + "-mongodb-networkpolicy", Namespace: mongo.Namespace},
+	}
+	if mongo.Spec.NetworkPolicy == nil {
+		// Look up the cache first so that nothing is sent to the API server unless there is a NetworkPolicy
+		err := r.Get(ctx, types.NamespacedName{Namespace: np.Namespace, Name: np.Name}, np)
+		if apierrs.IsNotFound(err) || (err == nil && !metav1.IsControlledBy(np, mongo)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.Delete(ctx, np); err != nil && !apierrs.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	op, err := apply(ctx, r.Client, r.Scheme, np, drift, func() error {
+		util.SetNetworkPolicyFields(np, mongo, defaults)
+		util.SetDefaultMetadata(np, defaults)
+		return controllerutil.SetControllerReference(mongo, np, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordOperation(log, mongo, op, "NetworkPolicy", np, ReasonNetworkPolicyCreated, ReasonNetworkPolicyUpdated)
+	if util.BlocksExternalClients(mongo) {
+		r.Recorder.Event(mongo, corev1.EventTypeWarning, ReasonExternalClientsBlocked,
+			"The NetworkPolicy blocks clients connecting through externalAccess, list their addresses by an ipBlock in networkPolicy.clients")
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var _ = Describe("reconcileNetworkPolicy", func() {
+	var mongo *v1alpha1.MongoDB
+	var c *deleteRecorder
+	var r *MongoDBReconciler
+	key := types.NamespacedName{Namespace: "default", Name: "foo-mongodb-networkpolicy"}
+
+	// reconcile removes spec.networkPolicy from the MongoDB and reconciles its NetworkPolicy with objs existing
+	reconcile := func(objs ...runtime.Object) error {
+		s := newScheme()
+		c = &deleteRecorder{Client: fake.NewFakeClientWithScheme(s, objs...)}
+		r = &MongoDBReconciler{Client: c, Scheme: s, Log: ctrl.Log, Recorder: record.NewFakeRecorder(10)}
+		return r.reconcileNetworkPolicy(context.Background(), r.Log, mongo, operatorconfig.Default(), nil)
+	}
+	networkPolicy := func() *networkingv1.NetworkPolicy {
+		return &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	}
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo-uid"}}
+	})
+
+	It("should not delete a missing NetworkPolicy", func() {
+		Expect(reconcile()).To(Succeed())
+		Expect(c.deleted).To(BeEmpty())
+	})
+
+	It("should delete the NetworkPolicy of the MongoDB", func() {
+		np := networkPolicy()
+		Expect(controllerutil.SetControllerReference(mongo, np, newScheme())).To(Succeed())
+		Expect(reconcile(np)).To(Succeed())
+
+		Expect(c.deleted).To(Equal([]string{key.Name}))
+		Expect(apierrs.IsNotFound(c.Get(context.Background(), key, networkPolicy()))).To(BeTrue())
+	})
+
+	It("should keep a NetworkPolicy not owned by the MongoDB", func() {
+		Expect(reconcile(networkPolicy())).To(Succeed())
+
+		Expect(c.deleted).To(BeEmpty())
+		Expect(c.Get(context.Background(), key, networkPolicy())).To(Succeed())
+	})
+})
@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// referencesHash returns a hash of the contents of the Secrets and ConfigMaps referenced by the MongoDB Pods.
+// Missing objects are skipped so that optional references do not block the reconcile.  The Secrets are read
+// uncached since they are not watched.
+func (r *MongoDBReconciler) referencesHash(ctx context.Context, mongo *v1alpha1.MongoDB) (string, error) {
+	secrets, configMaps := util.ReferencedObjects(mongo.Spec.PodTemplate)
+	if len(secrets) == 0 && len(configMaps) == 0 {
+		return "", nil
+	}
+
+	var secretObjects []corev1.Secret
+	for _, name := range secrets {
+		secret := &corev1.Secret{}
+		err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: mongo.Namespace, Name: name}, secret)
+		if apierrs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		secretObjects = append(secretObjects, *secret)
+	}
+	var configMapObjects []corev1.ConfigMap
+	for _, name := range configMaps {
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: mongo.Namespace, Name: name}, cm)
+		if apierrs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		configMapObjects = append(configMapObjects, *cm)
+	}
+	return util.ReferencesHash(secretObjects, configMapObjects), nil
+}
+
+// referencingMongoDBs maps a ConfigMap to the MongoDBs whose Pods reference it
+func (r *MongoDBReconciler) referencingMongoDBs(o handler.MapObject) []reconcile.Request {
+	list := &v1alpha1.MongoDBList{}
+	if err := r.List(context.Background(), list, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list MongoDBs", "namespace", o.Meta.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, mongo := range list.Items {
+		if !r.selects(&mongo) {
+			continue
+		}
+		_, configMaps := util.ReferencedObjects(mongo.Spec.PodTemplate)
+		for _, name := range configMaps {
+			if name == o.Meta.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: mongo.Namespace, Name: mongo.Name},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("referencesHash", func() {
+	It("should read the Secrets uncached", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		mongo.Spec.PodTemplate = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{
+			{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+		}}}
+		secret := corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+			Data:       map[string][]byte{"tls.crt": []byte("foo")},
+		}
+		s := newScheme()
+		r := &MongoDBReconciler{
+			Client:    fake.NewFakeClientWithScheme(s),
+			APIReader: fake.NewFakeClientWithScheme(s, secret.DeepCopy()),
+			Scheme:    s,
+		}
+
+		hash, err := r.referencesHash(context.Background(), mongo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(util.ReferencesHash([]corev1.Secret{secret}, nil)))
+	})
+})
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// observeReplicaSet records the state of the replica set in the status, emitting events when it is
+// initiated, members are added or removed, and the primary changes.  Errors are only logged since the
+// members are not reachable until they have started.  Standalone MongoDBs have no replica set to observe.
+func (r *MongoDBReconciler) observeReplicaSet(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, service *corev1.Service) {
+	if r.Dial == nil || mongo.Spec.IsStandalone() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	host := fmt.Sprintf("%s.%s.svc:27017", service.Name, service.Namespace)
+	c, err := r.Dial(ctx, []string{host})
+	if err != nil {
+		log.V(1).Info("unable to connect to replica set", "host", host, "error", err.Error())
+		return
+	}
+	defer c.Close(ctx)
+
+	status, err := c.Status(ctx)
+	if err != nil {
+		log.V(1).Info("unable to get replica set status", "host", host, "error", err.Error())
+		return
+	}
+
+	observed := &v1alpha1.ReplicaSetStatus{Initialized: status.Initialized, Primary: status.Primary()}
+	for _, m := range status.Members {
+		observed.Members = append(observed.Members, v1alpha1.MemberStatus{
+			Name:    m.Name,
+			Type:    memberType(mongo, m.Name),
+			State:   m.StateStr,
+			Healthy: m.Health == 1,
+		})
+	}
+
+	previous := mongo.Status.ReplicaSet
+	if previous == nil {
+		previous = &v1alpha1.ReplicaSetStatus{}
+	}
+	if observed.Initialized && !previous.Initialized {
+		r.Recorder.Event(mongo, corev1.EventTypeNormal, ReasonReplicaSetInitiated, "Replica set initiated")
+	}
+
+	previousMembers := map[string]bool{}
+	for _, m := range previous.Members {
+		previousMembers[m.Name] = true
+	}
+	observedMembers := map[string]bool{}
+	for _, m := range observed.Members {
+		observedMembers[m.Name] = true
+		if !previousMembers[m.Name] {
+			r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonMemberAdded, "Member %s added to the replica set", m.Name)
+		}
+	}
+	for _, m := range previous.Members {
+		if !observedMembers[m.Name] {
+			r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonMemberRemoved, "Member %s removed from the replica set", m.Name)
+		}
+	}
+
+	switch {
+	case observed.Primary != "" && observed.Primary != previous.Primary:
+		r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonPrimaryChanged, "Member %s is now primary", observed.Primary)
+	case observed.Primary == "" && previous.Primary != "":
+		r.Recorder.Eventf(mongo, corev1.EventTypeWarning, ReasonNoPrimary, "Replica set has no primary, previous primary was %s", previous.Primary)
+	}
+
+	mongo.Status.ReplicaSet = observed
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var _ = Describe("observeReplicaSet", func() {
+	var r *MongoDBReconciler
+	var recorder *record.FakeRecorder
+	var rs *fakeReplicaSet
+	var mongo *v1alpha1.MongoDB
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service", Namespace: "default"}}
+
+	// member returns the status of the member foo-mongodb-<ordinal> in the given state
+	member := func(ordinal, state string) replicaset.MemberStatus {
+		return replicaset.MemberStatus{Name: "foo-mongodb-" + ordinal + ".foo-mongodb-service.default.svc:27017", Health: 1, StateStr: state}
+	}
+	observe := func(members ...replicaset.MemberStatus) {
+		rs.status = &replicaset.Status{Initialized: true, Members: members}
+		r.observeReplicaSet(context.Background(), r.Log, mongo, service)
+	}
+	events := func() []string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		rs = &fakeReplicaSet{}
+		r = &MongoDBReconciler{Log: ctrl.Log, Recorder: recorder, Dial: rs.dial}
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		observe(member("0", replicaset.StatePrimary), member("1", replicaset.StateSecondary))
+		Expect(events()).To(HaveLen(4))
+	})
+
+	It("should record the members and the primary", func() {
+		Expect(mongo.Status.ReplicaSet.Initialized).To(BeTrue())
+		Expect(mongo.Status.ReplicaSet.Primary).To(Equal(member("0", "").Name))
+		Expect(mongo.Status.ReplicaSet.Members).To(Equal([]v1alpha1.MemberStatus{
+			{Name: member("0", "").Name, Type: v1alpha1.MemberTypeData, State: replicaset.StatePrimary, Healthy: true},
+			{Name: member("1", "").Name, Type: v1alpha1.MemberTypeData, State: replicaset.StateSecondary, Healthy: true},
+		}))
+
+		observe(member("0", replicaset.StatePrimary), member("1", replicaset.StateSecondary))
+		Expect(events()).To(BeEmpty())
+	})
+
+	It("should emit events for added and removed members", func() {
+		observe(member("0", replicaset.StatePrimary), member("2", replicaset.StateSecondary))
+
+		events := events()
+		Expect(events).To(HaveLen(2))
+		Expect(events[0]).To(ContainSubstring(ReasonMemberAdded))
+		Expect(events[0]).To(ContainSubstring(member("2", "").Name))
+		Expect(events[1]).To(ContainSubstring(ReasonMemberRemoved))
+		Expect(events[1]).To(ContainSubstring(member("1", "").Name))
+	})
+
+	It("should emit events when the primary changes or is lost", func() {
+		observe(member("0", replicaset.StateSecondary), member("1", replicaset.StatePrimary))
+		Expect(events()).To(Equal([]string{
+			corev1.EventTypeNormal + " " + ReasonPrimaryChanged + " Member " + member("1", "").Name + " is now primary",
+		}))
+
+		observe(member("0", replicaset.StateSecondary), member("1", "RECOVERING"))
+		Expect(mongo.Status.ReplicaSet.Primary).To(BeEmpty())
+		Expect(events()).To(Equal([]string{
+			corev1.EventTypeWarning + " " + ReasonNoPrimary + " Replica set has no primary, previous primary was " + member("1", "").Name,
+		}))
+	})
+
+	It("should keep the status while the replica set is unreachable", func() {
+		r.Dial = unreachable
+		observe()
+		Expect(mongo.Status.ReplicaSet.Members).To(HaveLen(2))
+		Expect(events()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,238 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/util"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// addFinalizer adds the TerminationFinalizer so that the terminationPolicy is enforced on deletion
+func (r *MongoDBReconciler) addFinalizer(ctx context.Context, mongo *v1alpha1.MongoDB) error {
+	if containsString(mongo.Finalizers, v1alpha1.TerminationFinalizer) {
+		return nil
+	}
+	mongo.Finalizers = append(mongo.Finalizers, v1alpha1.TerminationFinalizer)
+	return r.Update(ctx, mongo)
+}
+
+// finalize enforces the terminationPolicy of a deleted MongoDB and removes the TerminationFinalizer once
+// done.  The generated objects are garbage collected after the finalizer is removed.
+func (r *MongoDBReconciler) finalize(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, service *corev1.Service, ss *appsv1.StatefulSet) (ctrl.Result, error) {
+	if !containsString(mongo.Finalizers, v1alpha1.TerminationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	policy := mongo.Spec.EffectiveTerminationPolicy()
+	log = log.WithValues("terminationPolicy", policy)
+
+	switch policy {
+	case v1alpha1.TerminationPolicyDoNotTerminate:
+		// Only reached if the deletion webhook is not deployed.  The finalizer keeps all objects in place
+		// until the terminationPolicy is changed.
+		log.Info("deletion blocked by the termination policy")
+		r.Recorder.Eventf(mongo, corev1.EventTypeWarning, ReasonDeletionBlocked,
+			"Deletion is blocked by terminationPolicy %s, change the terminationPolicy to delete the MongoDB", policy)
+		return ctrl.Result{}, nil
+
+	case v1alpha1.TerminationPolicyDelete, v1alpha1.TerminationPolicyWipeOut:
+		if mongo.Spec.FinalBackup != nil {
+			done, err := r.finalBackup(ctx, log, mongo, service)
+			if err != nil {
+				return r.failed(log, mongo, causeFinalBackup, err)
+			}
+			if !done {
+				// The Job completing triggers the next reconcile
+				return ctrl.Result{}, nil
+			}
+		}
+		if err := r.deleteData(ctx, log, mongo, ss, policy == v1alpha1.TerminationPolicyWipeOut); err != nil {
+			return r.failed(log, mongo, causeTermination, err)
+		}
+	}
+
+	mongo.Finalizers = removeString(mongo.Finalizers, v1alpha1.TerminationFinalizer)
+	if err := r.Update(ctx, mongo); err != nil {
+		return r.failed(log, mongo, causeFinalizer, err)
+	}
+	log.Info("finalized MongoDB, generated objects will be garbage collected")
+	deleteInstanceMetrics(mongo.Namespace, mongo.Name)
+	r.Requeue.Forget(types.NamespacedName{Namespace: mongo.Namespace, Name: mongo.Name})
+	return ctrl.Result{}, nil
+}
+
+// finalBackup runs a Job taking a mongodump of the MongoDB and returns true once it succeeded.  A failed
+// backup blocks the deletion until the Job is deleted to retry, or finalBackup is removed from the spec.
+func (r *MongoDBReconciler) finalBackup(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, service *corev1.Service) (bool, error) {
+	job := &batchv1.Job{}
+	name := types.NamespacedName{Namespace: mongo.Namespace, Name: mongo.Name + "-mongodb-final-backup"}
+	err := r.Get(ctx, name, job)
+	if apierrs.IsNotFound(err) {
+		// The Job spec is immutable, so it is only created and never updated
+		job = &batchv1.Job{ObjectMeta: ctrl.ObjectMeta{Name: name.Name, Namespace: name.Namespace}}
+		defaults := r.defaults()
+		util.SetFinalBackupJobFields(job, service, mongo, mongo.Spec.FinalBackup, defaults.Image(defaults.Images.Mongo))
+		if err := controllerutil.SetControllerReference(mongo, job, r.Scheme); err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, job); err != nil {
+			return false, err
+		}
+		log.Info("started final backup", "job", job.Name, "archive", util.FinalBackupArchive(mongo))
+		backups.WithLabelValues(resultStarted).Inc()
+		r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonBackupStarted,
+			"Started final backup %s to PersistentVolumeClaim %s", util.FinalBackupArchive(mongo), mongo.Spec.FinalBackup.ClaimName)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			log.Info("final backup succeeded", "job", job.Name)
+			backups.WithLabelValues(resultSucceeded).Inc()
+			r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonBackupSucceeded,
+				"Final backup %s succeeded", util.FinalBackupArchive(mongo))
+			return true, nil
+		case batchv1.JobFailed:
+			log.Info("final backup failed, deletion blocked", "job", job.Name, "reason", c.Reason)
+			backups.WithLabelValues(resultFailed).Inc()
+			r.Recorder.Eventf(mongo, corev1.EventTypeWarning, ReasonBackupFailed,
+				"Final backup failed: %s. Delete Job %s to retry or remove finalBackup to delete the MongoDB without a backup",
+				c.Message, job.Name)
+			return false, nil
+		}
+	}
+	log.V(1).Info("waiting for final backup", "job", job.Name)
+	return false, nil
+}
+
+// deleteData deletes the StatefulSets holding data and the PersistentVolumeClaims of their members, and the Secrets
+// referenced by the podTemplate which belong to the MongoDB if wipeOut is set.  Referenced Secrets owned by the
+// user, e.g. image pull or TLS Secrets shared with other workloads, are never deleted.  The StatefulSets are deleted
+// first so that they do not recreate the claims.
+func (r *MongoDBReconciler) deleteData(ctx context.Context, log logr.Logger, mongo *v1alpha1.MongoDB, ss *appsv1.StatefulSet, wipeOut bool) error {
+	// Hidden and delayed members hold the data as well
+	names := []string{ss.Name, util.MemberSetName(mongo, util.ComponentHidden), util.MemberSetName(mongo, util.ComponentDelayed)}
+
+	// The claims are matched by the volume claim templates of the live StatefulSets.  The generated template is
+	// assumed if a StatefulSet was already deleted by a previous attempt.
+	var statefulSets []*appsv1.StatefulSet
+	for _, name := range names {
+		s := &appsv1.StatefulSet{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: mongo.Namespace, Name: name}, s)
+		if apierrs.IsNotFound(err) {
+			s = &appsv1.StatefulSet{ObjectMeta: ctrl.ObjectMeta{Name: name, Namespace: mongo.Namespace}}
+			s.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{ObjectMeta: ctrl.ObjectMeta{Name: util.DataVolume}}}
+			statefulSets = append(statefulSets, s)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := r.Delete(ctx, s, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrs.IsNotFound(err) {
+			return err
+		}
+		statefulSets = append(statefulSets, s)
+	}
+	claims := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, claims, client.InNamespace(mongo.Namespace)); err != nil {
+		return err
+	}
+	var deleted []string
+	for i := range claims.Items {
+		claim := &claims.Items[i]
+		if !isMemberClaim(statefulSets, claim.Name) {
+			continue
+		}
+		if err := r.Delete(ctx, claim); err != nil && !apierrs.IsNotFound(err) {
+			return err
+		}
+		deleted = append(deleted, claim.Name)
+	}
+
+	if wipeOut {
+		secrets, _ := util.ReferencedObjects(mongo.Spec.PodTemplate)
+		for _, name := range secrets {
+			secret := &corev1.Secret{}
+			err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: mongo.Namespace, Name: name}, secret)
+			if apierrs.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !util.IsOwnedSecret(secret, mongo) {
+				log.V(1).Info("keeping referenced Secret owned by the user", "secret", name)
+				continue
+			}
+			if err := r.Delete(ctx, secret); err != nil && !apierrs.IsNotFound(err) {
+				return err
+			}
+			deleted = append(deleted, name)
+		}
+	}
+
+	log.Info("deleted data", "objects", deleted)
+	r.Recorder.Eventf(mongo, corev1.EventTypeNormal, ReasonDataDeleted, "Deleted %v", deleted)
+	return nil
+}
+
+func containsString(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(s []string, v string) []string {
+	var result []string
+	for _, item := range s {
+		if item != v {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// isMemberClaim returns true if the PersistentVolumeClaim was created for a member of any of the StatefulSets
+func isMemberClaim(statefulSets []*appsv1.StatefulSet, claim string) bool {
+	for _, ss := range statefulSets {
+		if util.IsMemberClaim(ss, claim) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,13 +3,25 @@ module github.com/pwittrock/kubebuilder-workshop
 go 1.12
 
 require (
+	github.com/evanphx/json-patch v4.1.0+incompatible
 	github.com/go-logr/logr v0.1.0
+	github.com/go-logr/zapr v0.1.0
+	github.com/go-stack/stack v1.8.1 // indirect
+	github.com/golang/snappy v1.0.0 // indirect
+	github.com/google/gofuzz v0.0.0-20170612174753-24818f796faf
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.5.0
+	github.com/prometheus/client_golang v0.9.0
+	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910
+	github.com/xdg/scram v1.0.5 // indirect
+	github.com/xdg/stringprep v1.0.3 // indirect
+	go.mongodb.org/mongo-driver v1.0.3
+	go.uber.org/zap v1.9.1
 	golang.org/x/net v0.0.0-20190501004415-9ce7a6920f09
 	k8s.io/api v0.0.0-20190409021203-6e4e0e4f393b
 	k8s.io/apimachinery v0.0.0-20190404173353-6a84e37a896d
 	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
 	sigs.k8s.io/controller-runtime v0.2.0-beta.1
-	sigs.k8s.io/controller-tools v0.2.0-beta.1 // indirect
+	sigs.k8s.io/controller-tools v0.2.0 // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
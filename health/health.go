@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health serves the liveness and readiness probes of the manager
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Probes serves /healthz, which succeeds as long as the process is serving, and /readyz, which succeeds
+// once the manager caches have synced.  Probes is started by the manager on every replica, whether or not
+// it holds the leader lease, so that standby replicas are reported ready.
+type Probes struct {
+	// Addr is the address the probes are served on
+	Addr string
+
+	ready int32
+}
+
+// Start implements manager.Runnable.  The manager starts it after the caches have synced.
+func (p *Probes) Start(stop <-chan struct{}) error {
+	atomic.StoreInt32(&p.ready, 1)
+	<-stop
+	atomic.StoreInt32(&p.ready, 0)
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (p *Probes) NeedLeaderElection() bool {
+	return false
+}
+
+// ListenAndServe serves the probes until stop is closed.  It is started before the manager so that
+// liveness probes succeed while the caches sync.
+func (p *Probes) ListenAndServe(stop <-chan struct{}) error {
+	server := &http.Server{Addr: p.Addr, Handler: p.handler()}
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// handler returns the handler serving the probes
+func (p *Probes) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&p.ready) == 0 {
+			http.Error(w, "caches not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Probes", func() {
+	var p *Probes
+	var stop chan struct{}
+	var stopped chan error
+
+	// get returns the status code of the probe at path
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		p.handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	BeforeEach(func() {
+		p = &Probes{}
+		stop = make(chan struct{})
+		stopped = make(chan error, 1)
+	})
+
+	It("should only be live before the caches synced", func() {
+		Expect(get("/healthz")).To(Equal(http.StatusOK))
+		Expect(get("/readyz")).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should be ready once started until stopped", func() {
+		go func() { stopped <- p.Start(stop) }()
+		Eventually(func() int { return get("/readyz") }).Should(Equal(http.StatusOK))
+		Expect(get("/healthz")).To(Equal(http.StatusOK))
+
+		close(stop)
+		Eventually(stopped).Should(Receive(BeNil()))
+		Expect(get("/readyz")).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should run on standby replicas", func() {
+		Expect(p.NeedLeaderElection()).To(BeFalse())
+	})
+})
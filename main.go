@@ -18,17 +18,31 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 
 	databasesv1alpha1 "github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	databasesv1beta1 "github.com/pwittrock/kubebuilder-workshop/api/v1beta1"
 	"github.com/pwittrock/kubebuilder-workshop/controllers"
+	"github.com/pwittrock/kubebuilder-workshop/health"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+	"github.com/pwittrock/kubebuilder-workshop/requeue"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -40,40 +54,194 @@ var (
 func init() {
 
 	databasesv1alpha1.AddToScheme(scheme)
+	databasesv1beta1.AddToScheme(scheme)
 	appsv1.AddToScheme(scheme)
+	batchv1.AddToScheme(scheme)
 	corev1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
-	var metricsAddr string
+	var metricsAddr, healthAddr string
+	var enableLeaderElection bool
+	var leaderElectionNamespace, leaderElectionID string
+	var namespaces, watchSelector string
+	var logLevel, logFormat string
+	var configFile string
+	var enableWebhooks bool
+	requeuePolicy := requeue.Default()
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&healthAddr, "health-addr", ":9440", "The address the /healthz and /readyz probes bind to.")
+	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
+		"Enable leader election for the manager. Enabling this ensures there is only one active manager.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace of the leader election lock. Defaults to the namespace the manager runs in.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", "kubebuilder-workshop-leader-election",
+		"The name of the leader election lock. Operator instances sharding MongoDBs with --watch-selector must use different IDs.")
+	flag.StringVar(&namespaces, "namespaces", "",
+		"Comma separated list of namespaces to watch. Defaults to all namespaces.")
+	flag.StringVar(&watchSelector, "watch-selector", "",
+		"Label selector of the MongoDBs reconciled by this operator instance, e.g. shard=a. Defaults to all MongoDBs.")
+	flag.StringVar(&logLevel, "log-level", "info", "The minimum level to log, one of debug, info or error.")
+	flag.StringVar(&logFormat, "log-format", "console", "The log format, one of console or json.")
+	flag.StringVar(&configFile, "config", "",
+		"The operator configuration file with the defaults of the generated objects. It is reloaded when it changes.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the admission webhooks, e.g. the one rejecting deletion of MongoDBs with the DoNotTerminate termination policy, "+
+			"and the conversion webhook of the v1beta1 API. Requires the webhook serving certificate.")
+	flag.DurationVar(&requeuePolicy.Progressing, "progressing-requeue-interval", requeuePolicy.Progressing,
+		"How often objects which are not ready yet are reconciled again to follow rollouts and membership changes. 0 disables the requeue.")
+	flag.DurationVar(&requeuePolicy.Resync, "resync-interval", requeuePolicy.Resync,
+		"How often ready objects are reconciled again to re-check the health of their members and the referenced "+
+			"Secrets, which are not watched. 0 disables the resync.")
+	flag.DurationVar(&requeuePolicy.MinBackoff, "min-retry-backoff", requeuePolicy.MinBackoff,
+		"The delay before a failed reconcile is retried. It doubles with every consecutive failure up to --max-retry-backoff.")
+	flag.DurationVar(&requeuePolicy.MaxBackoff, "max-retry-backoff", requeuePolicy.MaxBackoff,
+		"The maximum delay before a failed reconcile is retried.")
 	flag.Parse()
 
-	ctrl.SetLogger(zap.Logger(true))
+	logger, err := newLogger(logLevel, logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(logger)
+
+	selector, err := labels.Parse(watchSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid --watch-selector")
+		os.Exit(1)
+	}
+	if err := requeuePolicy.Validate(); err != nil {
+		setupLog.Error(err, "invalid requeue flags")
+		os.Exit(1)
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{Scheme: scheme, MetricsBindAddress: metricsAddr})
+	options := ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaderElectionID:        leaderElectionID,
+	}
+	// Only cache the selected namespaces so that namespaced RBAC is sufficient
+	if watched := splitNamespaces(namespaces); len(watched) == 1 {
+		options.Namespace = watched[0]
+	} else if len(watched) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(watched)
+	}
+	setupLog.Info("watching", "namespaces", namespaces, "selector", selector.String())
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	probes := &health.Probes{Addr: healthAddr}
+	if err := mgr.Add(probes); err != nil {
+		setupLog.Error(err, "unable to add health probes")
+		os.Exit(1)
+	}
+
+	// Fall back to the compiled in defaults if there is no configuration file
+	var defaults *operatorconfig.Watcher
+	if configFile != "" {
+		defaults, err = operatorconfig.NewWatcher(configFile, ctrl.Log.WithName("operatorconfig"))
+		if err != nil {
+			setupLog.Error(err, "unable to load operator configuration", "path", configFile)
+			os.Exit(1)
+		}
+		if err := mgr.Add(defaults); err != nil {
+			setupLog.Error(err, "unable to add operator configuration watcher")
+			os.Exit(1)
+		}
+	}
+
 	err = (&controllers.MongoDBReconciler{
+		Scheme:    mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("MongoDB"),
+		Recorder:  mgr.GetEventRecorderFor("mongodb"),
+		Dial:      replicaset.Dial,
+		Selector:  selector,
+		Defaults:  defaults,
+		APIReader: mgr.GetAPIReader(),
+		Requeue:   requeue.NewTracker(requeuePolicy),
+	}).SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MongoDB")
+		os.Exit(1)
+	}
+
+	err = (&controllers.MongoDBShardedClusterReconciler{
 		Scheme:   mgr.GetScheme(),
 		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("MongoDB"),
-		Recorder: mgr.GetEventRecorderFor("mongodb"),
+		Log:      ctrl.Log.WithName("controllers").WithName("MongoDBShardedCluster"),
+		Recorder: mgr.GetEventRecorderFor("mongodbshardedcluster"),
+		Dial:     replicaset.Dial,
+		Selector: selector,
+		Defaults: defaults,
+		Requeue:  requeue.NewTracker(requeuePolicy),
 	}).SetupWithManager(mgr)
 	if err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "MongoDB")
+		setupLog.Error(err, "unable to create controller", "controller", "MongoDBShardedCluster")
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err = (&databasesv1alpha1.MongoDB{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MongoDB")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	stop := ctrl.SetupSignalHandler()
+	go func() {
+		if err := probes.ListenAndServe(stop); err != nil {
+			setupLog.Error(err, "problem serving health probes")
+			os.Exit(1)
+		}
+	}()
+
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// splitNamespaces splits the comma separated list of namespaces, ignoring empty entries
+func splitNamespaces(namespaces string) []string {
+	var result []string
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			result = append(result, ns)
+		}
+	}
+	return result
+}
+
+// newLogger returns a logger writing to stderr at the given level in the given format.  debug enables
+// the V(1) log lines of the controllers.
+func newLogger(level, format string) (logr.Logger, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level %q: %v", level, err)
+	}
+
+	var enc zapcore.Encoder
+	switch format {
+	case "console":
+		enc = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	case "json":
+		enc = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	default:
+		return nil, fmt.Errorf("invalid --log-format %q, must be one of console or json", format)
+	}
+
+	sink := zapcore.AddSync(os.Stderr)
+	core := zapcore.NewCore(&ctrlzap.KubeAwareEncoder{Encoder: enc}, sink, zap.NewAtomicLevelAt(lvl))
+	return zapr.NewLogger(zap.New(core, zap.AddStacktrace(zap.ErrorLevel), zap.ErrorOutput(sink))), nil
+}
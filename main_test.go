@@ -0,0 +1,35 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("splitNamespaces", func() {
+	table.DescribeTable("should drop empty entries and whitespace",
+		func(namespaces string, want []string) {
+			Expect(splitNamespaces(namespaces)).To(Equal(want))
+		},
+		table.Entry("no namespaces", "", nil),
+		table.Entry("only separators and whitespace", " , ,", nil),
+		table.Entry("a single namespace", "team-a", []string{"team-a"}),
+		table.Entry("several namespaces", "team-a, team-b ,,team-c,", []string{"team-a", "team-b", "team-c"}),
+	)
+})
@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operatorconfig contains the cluster-wide defaults of the operator, loaded from a configuration file
+package operatorconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// OperatorLabel is set to OperatorLabelValue on the namespace and the Pods of the deployed operator, so that the
+// default NetworkPolicyPeers admit no other Pods
+const (
+	OperatorLabel      = "databases.example.com/operator"
+	OperatorLabelValue = "kubebuilder-workshop"
+)
+
+// Config contains the defaults applied to the objects generated for every MongoDB.  Fields of the
+// MongoDB spec take precedence over the defaults.
+type Config struct {
+	// ImageRegistry is prepended to the repository of all images, e.g. registry.example.com/mirror
+	ImageRegistry string `json:"imageRegistry,omitempty"`
+
+	// Images of the containers in the generated Pods.  Changing them only applies to new instances, the
+	// containers of existing instances keep their images unless spec.podTemplate sets one.
+	Images Images `json:"images,omitempty"`
+
+	// Replicas is the number of members if spec.replicas is not set
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Storage is the size of the data volume if spec.storage is not set
+	Storage string `json:"storage,omitempty"`
+
+	// StorageClassName of the data volume.  The cluster default storage class is used if empty.
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// TerminationGracePeriodSeconds of the generated Pods
+	TerminationGracePeriodSeconds int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// Resources of the mongo container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Labels are added to all generated objects.  They are not added to the Pods so that changing them does not
+	// restart the members.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to all generated objects, but not to the Pods
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// NetworkPolicyPeers are allowed to connect to the members by the NetworkPolicies generated for
+	// spec.networkPolicy.  They must select the operator Pods, which manage the replica sets.  The default only
+	// selects the Pods labeled with OperatorLabel in the namespace labeled with it.
+	NetworkPolicyPeers []networkingv1.NetworkPolicyPeer `json:"networkPolicyPeers,omitempty"`
+}
+
+// Images contains the images of the containers in the generated Pods
+type Images struct {
+	// Mongo runs mongod
+	Mongo Image `json:"mongo,omitempty"`
+
+	// Exporter serves the Prometheus metrics if spec.monitoring.image is not set
+	Exporter Image `json:"exporter,omitempty"`
+
+	// Sidecar is ignored.
+	//
+	// Deprecated: the replica set membership is managed by the operator instead of a sidecar.  The field is still
+	// parsed so that existing configuration files stay valid.
+	Sidecar *Image `json:"sidecar,omitempty"`
+}
+
+// Image is a container image
+type Image struct {
+	// Repository of the image, e.g. mongo
+	Repository string `json:"repository,omitempty"`
+
+	// Tag is the version of the image.  The latest image is used if empty.
+	Tag string `json:"tag,omitempty"`
+}
+
+// Default returns the defaults used if no configuration file is given
+func Default() *Config {
+	return &Config{
+		Images: Images{
+			Mongo:    Image{Repository: "mongo"},
+			Exporter: Image{Repository: "percona/mongodb_exporter", Tag: "0.11.0"},
+		},
+		Replicas:                      1,
+		Storage:                       "100Gi",
+		TerminationGracePeriodSeconds: 10,
+		NetworkPolicyPeers: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{OperatorLabel: OperatorLabelValue}},
+			PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{OperatorLabel: OperatorLabelValue}},
+		}},
+	}
+}
+
+// Load reads the configuration file at path.  Fields missing from the file keep their defaults.
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses and validates the YAML configuration on top of the defaults
+func Parse(b []byte) (*Config, error) {
+	c := Default()
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("invalid operator configuration: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid operator configuration: %v", err)
+	}
+	return c, nil
+}
+
+// Validate returns an error if the configuration cannot be applied to the generated objects
+func (c *Config) Validate() error {
+	if c.Replicas < 1 {
+		return fmt.Errorf("replicas must be at least 1")
+	}
+	if _, err := resource.ParseQuantity(c.Storage); err != nil {
+		return fmt.Errorf("storage: %v", err)
+	}
+	if c.TerminationGracePeriodSeconds < 0 {
+		return fmt.Errorf("terminationGracePeriodSeconds must not be negative")
+	}
+	for name, image := range map[string]Image{
+		"mongo":    c.Images.Mongo,
+		"exporter": c.Images.Exporter,
+	} {
+		if image.Repository == "" {
+			return fmt.Errorf("images.%s.repository must be set", name)
+		}
+	}
+	return nil
+}
+
+// Image returns the full name of the image, including the registry and tag
+func (c *Config) Image(image Image) string {
+	name := image.Repository
+	if c.ImageRegistry != "" {
+		name = strings.TrimSuffix(c.ImageRegistry, "/") + "/" + name
+	}
+	if image.Tag != "" {
+		name += ":" + image.Tag
+	}
+	return name
+}
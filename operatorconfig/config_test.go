@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("Parse", func() {
+	It("should keep defaults for fields missing from the file", func() {
+		c, err := Parse([]byte("storageClassName: fast\nimages:\n  mongo:\n    tag: \"4.0\"\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.StorageClassName).To(Equal("fast"))
+		Expect(c.Storage).To(Equal("100Gi"))
+		Expect(c.Replicas).To(Equal(int32(1)))
+		Expect(c.Images.Mongo).To(Equal(Image{Repository: "mongo", Tag: "4.0"}))
+	})
+
+	It("should match the defaults in the deployed ConfigMap", func() {
+		b, err := ioutil.ReadFile("../config/manager/operator_config.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		cm := &corev1.ConfigMap{}
+		Expect(yaml.Unmarshal(b, cm)).To(Succeed())
+
+		c, err := Parse([]byte(cm.Data["config.yaml"]))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(Equal(Default()))
+	})
+
+	It("should only admit the deployed operator to the members by default", func() {
+		b, err := ioutil.ReadFile("../config/manager/manager.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		var namespace corev1.Namespace
+		var deployment appsv1.Deployment
+		for _, doc := range strings.Split(string(b), "\n---\n") {
+			meta := &metav1.TypeMeta{}
+			Expect(yaml.Unmarshal([]byte(doc), meta)).To(Succeed())
+			switch meta.Kind {
+			case "Namespace":
+				Expect(yaml.Unmarshal([]byte(doc), &namespace)).To(Succeed())
+			case "Deployment":
+				Expect(yaml.Unmarshal([]byte(doc), &deployment)).To(Succeed())
+			}
+		}
+
+		peers := Default().NetworkPolicyPeers
+		Expect(peers).To(HaveLen(1))
+		namespaces, err := metav1.LabelSelectorAsSelector(peers[0].NamespaceSelector)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces.Matches(labels.Set(namespace.Labels))).To(BeTrue())
+		Expect(namespaces.Matches(labels.Set{"control-plane": "controller-manager"})).To(BeFalse())
+		pods, err := metav1.LabelSelectorAsSelector(peers[0].PodSelector)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods.Matches(labels.Set(deployment.Spec.Template.Labels))).To(BeTrue())
+		Expect(pods.Matches(labels.Set{"control-plane": "controller-manager"})).To(BeFalse())
+	})
+
+	It("should reject unknown fields", func() {
+		_, err := Parse([]byte("storageClass: fast\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should ignore the deprecated sidecar image", func() {
+		c, err := Parse([]byte("images:\n  mongo:\n    tag: \"4.0\"\n  sidecar:\n    repository: cvallance/mongo-k8s-sidecar\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Images.Mongo).To(Equal(Image{Repository: "mongo", Tag: "4.0"}))
+	})
+
+	It("should reject an invalid storage size", func() {
+		_, err := Parse([]byte("storage: lots\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Image", func() {
+	It("should prepend the registry and append the tag", func() {
+		c := Default()
+		c.ImageRegistry = "registry.example.com/mirror/"
+		Expect(c.Image(c.Images.Mongo)).To(Equal("registry.example.com/mirror/mongo"))
+		Expect(c.Image(c.Images.Exporter)).To(Equal("registry.example.com/mirror/percona/mongodb_exporter:0.11.0"))
+	})
+})
@@ -0,0 +1,124 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DefaultInterval is how often the configuration file is checked for changes.  The kubelet updates
+// mounted ConfigMaps about once a minute, so polling is sufficient.
+const DefaultInterval = 10 * time.Second
+
+// Watcher reloads the configuration file when it changes.  An invalid file is logged and the previous
+// configuration is kept.
+type Watcher struct {
+	// Path of the configuration file
+	Path string
+
+	// Interval between checks for changes, defaults to DefaultInterval
+	Interval time.Duration
+
+	Log logr.Logger
+
+	mu       sync.RWMutex
+	config   *Config
+	contents []byte
+	handlers []func()
+}
+
+// NewWatcher loads the configuration file at path.  An error is returned if the file cannot be loaded.
+func NewWatcher(path string, log logr.Logger) (*Watcher, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(contents)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{Path: path, Log: log, config: config, contents: contents}, nil
+}
+
+// Config returns the current configuration.  It must not be modified.
+func (w *Watcher) Config() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.config
+}
+
+// OnChange registers f to be called after the configuration was reloaded
+func (w *Watcher) OnChange(f func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, f)
+}
+
+// Start implements manager.Runnable.  It checks the file for changes until stop is closed.  It only runs
+// on the leader so that the OnChange handlers can enqueue work; the file is checked as soon as a
+// replica is elected so that it does not act on a configuration loaded before it was elected.
+func (w *Watcher) Start(stop <-chan struct{}) error {
+	interval := w.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.reload()
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// reload loads the configuration file if its contents changed and calls the OnChange handlers
+func (w *Watcher) reload() {
+	contents, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		w.Log.Error(err, "unable to read operator configuration, keeping the previous configuration", "path", w.Path)
+		return
+	}
+
+	w.mu.Lock()
+	if bytes.Equal(contents, w.contents) {
+		w.mu.Unlock()
+		return
+	}
+	config, err := Parse(contents)
+	if err != nil {
+		w.mu.Unlock()
+		w.Log.Error(err, "keeping the previous configuration", "path", w.Path)
+		return
+	}
+	w.config = config
+	w.contents = contents
+	handlers := append([]func(){}, w.handlers...)
+	w.mu.Unlock()
+
+	w.Log.Info("reloaded operator configuration", "path", w.Path)
+	for _, f := range handlers {
+		f()
+	}
+}
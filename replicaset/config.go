@@ -0,0 +1,258 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaset
+
+import (
+	"strings"
+)
+
+// MaxVotingMembers is the maximum number of voting members of a replica set
+const MaxVotingMembers = 7
+
+// Config is the replica set configuration returned by replSetGetConfig.  Fields not used by the operator are
+// kept in Extra so that reconfiguring the replica set does not reset them.
+type Config struct {
+	ID      string                 `bson:"_id"`
+	Version int                    `bson:"version"`
+	Members []MemberConfig         `bson:"members"`
+	Extra   map[string]interface{} `bson:",inline"`
+}
+
+// MemberConfig is the configuration of a single replica set member
+type MemberConfig struct {
+	ID          int     `bson:"_id"`
+	Host        string  `bson:"host"`
+	ArbiterOnly bool    `bson:"arbiterOnly"`
+	Hidden      bool    `bson:"hidden"`
+	Priority    float64 `bson:"priority"`
+	Votes       int     `bson:"votes"`
+
+	// SlaveDelay is the replication delay of delayed members in seconds
+	SlaveDelay int64 `bson:"slaveDelay,omitempty"`
+
+	Tags map[string]string `bson:"tags,omitempty"`
+
+	// Horizons are the addresses of the member in other networks, keyed by horizon name.  All members must have
+	// the same horizons.
+	Horizons map[string]string `bson:"horizons,omitempty"`
+
+	Extra map[string]interface{} `bson:",inline"`
+}
+
+// ExternalHorizon is the name of the horizon of clients outside the Kubernetes cluster
+const ExternalHorizon = "external"
+
+// matches returns true if the member has the votes, priority, visibility and tags of want.  Horizons are changed
+// on all members at once and not compared.
+func (m *MemberConfig) matches(want MemberConfig) bool {
+	if m.Votes != want.Votes || m.Priority != want.Priority || m.Hidden != want.Hidden || m.SlaveDelay != want.SlaveDelay {
+		return false
+	}
+	return equalMaps(m.Tags, want.Tags)
+}
+
+// equalMaps returns true if a and b contain the same entries, treating nil and empty maps as equal
+func equalMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range b {
+		if w, ok := a[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Member returns the configuration of the member running in the Pod of host, or nil if there is none
+func (c *Config) Member(host string) *MemberConfig {
+	for i := range c.Members {
+		if PodName(c.Members[i].Host) == PodName(host) {
+			return &c.Members[i]
+		}
+	}
+	return nil
+}
+
+// VotingMembers returns the number of voting members
+func (c *Config) VotingMembers() int {
+	n := 0
+	for _, m := range c.Members {
+		if m.Votes > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// next returns a copy of the configuration with the version incremented
+func (c *Config) next() *Config {
+	next := *c
+	next.Version++
+	next.Members = append([]MemberConfig{}, c.Members...)
+	return &next
+}
+
+// PodName returns the name of the Pod running the member at host, which is the first label of the host name
+// of a StatefulSet member, e.g. foo-0 for foo-0.foo.default.svc:27017
+func PodName(host string) string {
+	host = strings.SplitN(host, ":", 2)[0]
+	return strings.SplitN(host, ".", 2)[0]
+}
+
+// Action is the kind of a Change
+type Action string
+
+const (
+	// ActionAdd adds a non-voting member
+	ActionAdd Action = "add"
+
+	// ActionUpdate updates the votes, priority, visibility and tags of a member
+	ActionUpdate Action = "update"
+
+	// ActionRemove removes a member
+	ActionRemove Action = "remove"
+
+	// ActionStepDown makes the primary step down before it is removed
+	ActionStepDown Action = "stepdown"
+
+	// ActionHorizons updates the horizons of all members at once
+	ActionHorizons Action = "horizons"
+)
+
+// Change is a single step bringing the replica set membership closer to the desired members
+type Change struct {
+	Action Action
+
+	// Member is the host of the changed member
+	Member string
+
+	// Config is applied with Reconfig.  It is nil for ActionStepDown.
+	Config *Config
+}
+
+// NextChange returns the next change bringing the members of config closer to want, or nil if the members match.
+// Only one member is changed at a time so that the voting majority is kept during each reconfiguration.
+// Members which are not wanted and for which remove returns true are removed first, highest id first, after
+// the primary stepped down if it is to be removed.  Wanted members are then added as non-voting members with
+// priority 0 once ready returns true for their host, and given their wanted votes and priority once they are
+// SECONDARY, i.e. caught up.  Arbiters hold no data to catch up on and are added with their wanted votes.
+// Horizons must be the same on all members, so they are changed on all members at once before members are added
+// and members are only added once they have the same horizons.
+func NextChange(config *Config, status *Status, want []MemberConfig, ready, remove func(host string) bool) *Change {
+	wanted := map[string]bool{}
+	for _, w := range want {
+		wanted[PodName(w.Host)] = true
+	}
+
+	for i := len(config.Members) - 1; i >= 0; i-- {
+		m := config.Members[i]
+		if wanted[PodName(m.Host)] || !remove(m.Host) {
+			continue
+		}
+		if s := status.Member(m.ID); s != nil && s.StateStr == StatePrimary {
+			return &Change{Action: ActionStepDown, Member: m.Host}
+		}
+		next := config.next()
+		next.Members = append(next.Members[:i], next.Members[i+1:]...)
+		return &Change{Action: ActionRemove, Member: m.Host, Config: next}
+	}
+
+	if next := withHorizons(config, want); next != nil {
+		return &Change{Action: ActionHorizons, Config: next}
+	}
+
+	for _, w := range want {
+		if config.Member(w.Host) != nil || !ready(w.Host) {
+			continue
+		}
+		if len(config.Members) > 0 && !sameKeys(w.Horizons, config.Members[0].Horizons) {
+			continue
+		}
+		next := config.next()
+		id := 0
+		for _, m := range config.Members {
+			if m.ID >= id {
+				id = m.ID + 1
+			}
+		}
+		added := MemberConfig{ID: id, Host: w.Host, Hidden: w.Hidden, SlaveDelay: w.SlaveDelay, Tags: w.Tags, Horizons: w.Horizons}
+		if w.ArbiterOnly {
+			added.ArbiterOnly = true
+			added.Votes = w.Votes
+		}
+		next.Members = append(next.Members, added)
+		return &Change{Action: ActionAdd, Member: w.Host, Config: next}
+	}
+
+	for _, w := range want {
+		m := config.Member(w.Host)
+		if m == nil || m.matches(w) {
+			continue
+		}
+		if s := status.Member(m.ID); s == nil || (s.StateStr != StateSecondary && s.StateStr != StatePrimary) {
+			continue
+		}
+		next := config.next()
+		updated := next.Member(w.Host)
+		updated.Votes = w.Votes
+		updated.Priority = w.Priority
+		updated.Hidden = w.Hidden
+		updated.SlaveDelay = w.SlaveDelay
+		updated.Tags = w.Tags
+		return &Change{Action: ActionUpdate, Member: m.Host, Config: next}
+	}
+	return nil
+}
+
+// withHorizons returns the configuration with the wanted horizons of all members, or nil if they already match,
+// a member which is not wanted cannot be given horizons or the wanted members do not have the same horizons yet
+func withHorizons(config *Config, want []MemberConfig) *Config {
+	wanted := map[string]MemberConfig{}
+	for _, w := range want {
+		wanted[PodName(w.Host)] = w
+	}
+	changed := false
+	for _, m := range config.Members {
+		w, ok := wanted[PodName(m.Host)]
+		if !ok || !sameKeys(w.Horizons, wanted[PodName(config.Members[0].Host)].Horizons) {
+			return nil
+		}
+		changed = changed || !equalMaps(m.Horizons, w.Horizons)
+	}
+	if !changed {
+		return nil
+	}
+	next := config.next()
+	for i := range next.Members {
+		next.Members[i].Horizons = wanted[PodName(next.Members[i].Host)].Horizons
+	}
+	return next
+}
+
+// sameKeys returns true if a and b have the same keys
+func sameKeys(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
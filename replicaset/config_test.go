@@ -0,0 +1,162 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaset
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NextChange", func() {
+	var config *Config
+	var status *Status
+	var want []MemberConfig
+	all := func(string) bool { return true }
+	none := func(string) bool { return false }
+
+	BeforeEach(func() {
+		config = &Config{ID: "rs0", Version: 3, Members: []MemberConfig{
+			{ID: 0, Host: "foo-0.foo.default.svc:27017", Votes: 1, Priority: 1},
+			{ID: 1, Host: "foo-1.foo.default.svc:27017", Votes: 1, Priority: 1},
+		}}
+		status = &Status{Initialized: true, Set: "rs0", Members: []MemberStatus{
+			{ID: 0, StateStr: StatePrimary},
+			{ID: 1, StateStr: StateSecondary},
+		}}
+		want = []MemberConfig{
+			{Host: "foo-0.foo.default.svc:27017", Votes: 1, Priority: 1},
+			{Host: "foo-1.foo.default.svc:27017", Votes: 1, Priority: 1},
+		}
+	})
+
+	It("should not change matching members", func() {
+		Expect(NextChange(config, status, want, all, all)).To(BeNil())
+	})
+
+	It("should add ready members without votes", func() {
+		want = append(want, MemberConfig{Host: "foo-2.foo.default.svc:27017", Votes: 1, Priority: 1})
+		Expect(NextChange(config, status, want, none, all)).To(BeNil())
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionAdd))
+		Expect(change.Config.Version).To(Equal(4))
+		Expect(change.Config.Members).To(HaveLen(3))
+		Expect(*change.Config.Member("foo-2")).To(Equal(MemberConfig{ID: 2, Host: "foo-2.foo.default.svc:27017"}))
+		Expect(config.Members).To(HaveLen(2))
+	})
+
+	It("should give added members votes once they caught up", func() {
+		want = append(want, MemberConfig{Host: "foo-2.foo.default.svc:27017", Votes: 1, Priority: 1})
+		config.Members = append(config.Members, MemberConfig{ID: 2, Host: "foo-2.foo.default.svc:27017"})
+		status.Members = append(status.Members, MemberStatus{ID: 2, StateStr: "STARTUP2"})
+		Expect(NextChange(config, status, want, all, all)).To(BeNil())
+
+		status.Members[2].StateStr = StateSecondary
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionUpdate))
+		Expect(change.Config.Member("foo-2").Votes).To(Equal(1))
+		Expect(change.Config.Member("foo-2").Priority).To(Equal(1.0))
+		Expect(config.Member("foo-2").Votes).To(Equal(0))
+	})
+
+	It("should remove the highest member first", func() {
+		config.Members = append(config.Members, MemberConfig{ID: 2, Host: "foo-2.foo.default.svc:27017", Votes: 1, Priority: 1})
+		status.Members = append(status.Members, MemberStatus{ID: 2, StateStr: StateSecondary})
+		want = want[:1]
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionRemove))
+		Expect(change.Member).To(Equal("foo-2.foo.default.svc:27017"))
+		Expect(change.Config.Members).To(HaveLen(2))
+	})
+
+	It("should step down the primary before it is removed", func() {
+		status.Members[0].StateStr = StateSecondary
+		status.Members[1].StateStr = StatePrimary
+		want = want[:1]
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionStepDown))
+		Expect(change.Member).To(Equal("foo-1.foo.default.svc:27017"))
+		Expect(change.Config).To(BeNil())
+	})
+
+	It("should add arbiters with their votes", func() {
+		want = append(want, MemberConfig{Host: "foo-arbiter-0.foo-arbiter.default.svc:27017", ArbiterOnly: true, Votes: 1})
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionAdd))
+		Expect(*change.Config.Member("foo-arbiter-0")).To(Equal(MemberConfig{ID: 2, Host: "foo-arbiter-0.foo-arbiter.default.svc:27017", ArbiterOnly: true, Votes: 1}))
+	})
+
+	It("should add delayed members hidden without votes", func() {
+		want = append(want, MemberConfig{Host: "foo-delayed-0.foo-delayed.default.svc:27017", Hidden: true, SlaveDelay: 3600})
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionAdd))
+		Expect(*change.Config.Member("foo-delayed-0")).To(Equal(MemberConfig{ID: 2, Host: "foo-delayed-0.foo-delayed.default.svc:27017", Hidden: true, SlaveDelay: 3600}))
+		Expect(NextChange(change.Config, status, want, all, all)).To(BeNil())
+	})
+
+	It("should hide members", func() {
+		want[1] = MemberConfig{Host: "foo-1.foo.default.svc:27017", Hidden: true}
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionUpdate))
+		Expect(*change.Config.Member("foo-1")).To(Equal(MemberConfig{ID: 1, Host: "foo-1.foo.default.svc:27017", Hidden: true}))
+	})
+
+	It("should tag members", func() {
+		want[0].Tags = map[string]string{"dc": "east"}
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionUpdate))
+		Expect(change.Config.Member("foo-0").Tags).To(Equal(map[string]string{"dc": "east"}))
+		Expect(NextChange(change.Config, status, want, all, all)).To(BeNil())
+	})
+
+	It("should change the horizons of all members at once", func() {
+		want[0].Horizons = map[string]string{ExternalHorizon: "10.0.0.1:27017"}
+		want[1].Horizons = map[string]string{ExternalHorizon: "10.0.0.2:27017"}
+		want = append(want, MemberConfig{Host: "foo-2.foo.default.svc:27017", Votes: 1, Priority: 1,
+			Horizons: map[string]string{ExternalHorizon: "10.0.0.3:27017"}})
+
+		change := NextChange(config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionHorizons))
+		Expect(change.Config.Member("foo-0").Horizons).To(Equal(want[0].Horizons))
+		Expect(change.Config.Member("foo-1").Horizons).To(Equal(want[1].Horizons))
+
+		change = NextChange(change.Config, status, want, all, all)
+		Expect(change.Action).To(Equal(ActionAdd))
+		Expect(change.Config.Member("foo-2").Horizons).To(Equal(want[2].Horizons))
+	})
+
+	It("should wait for the horizons of all members", func() {
+		want[0].Horizons = map[string]string{ExternalHorizon: "10.0.0.1:27017"}
+		Expect(NextChange(config, status, want, all, all)).To(BeNil())
+
+		want[0].Horizons = nil
+		want = append(want, MemberConfig{Host: "foo-2.foo.default.svc:27017", Votes: 1, Priority: 1,
+			Horizons: map[string]string{ExternalHorizon: "10.0.0.3:27017"}})
+		Expect(NextChange(config, status, want, all, all)).To(BeNil())
+	})
+
+	It("should keep members it may not remove", func() {
+		want = want[:1]
+		Expect(NextChange(config, status, want, all, none)).To(BeNil())
+	})
+})
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package replicaset contains a client for observing and managing MongoDB replica sets and the shards of
+// sharded clusters
+package replicaset
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notYetInitialized is the error code returned by replSetGetStatus before replSetInitiate was run
+const notYetInitialized = 94
+
+const (
+	// stepDownSeconds is how long a stepped down primary is not electable
+	stepDownSeconds = 60
+
+	// stepDownCatchUpSeconds is how long the primary waits for a secondary to catch up before stepping down
+	stepDownCatchUpSeconds = 10
+)
+
+// Member states reported by replSetGetStatus
+const (
+	StatePrimary   = "PRIMARY"
+	StateSecondary = "SECONDARY"
+)
+
+// Status is the subset of the replSetGetStatus output used by the operator
+type Status struct {
+	// Initialized is false if replSetInitiate has not been run yet
+	Initialized bool `bson:"-"`
+
+	// Set is the name of the replica set
+	Set string `bson:"set"`
+
+	// Members of the replica set
+	Members []MemberStatus `bson:"members"`
+}
+
+// MemberStatus is the status of a single replica set member
+type MemberStatus struct {
+	ID       int    `bson:"_id"`
+	Name     string `bson:"name"`
+	Health   int    `bson:"health"`
+	StateStr string `bson:"stateStr"`
+}
+
+// Member returns the status of the member with the given id, or nil if it is not in the status
+func (s *Status) Member(id int) *MemberStatus {
+	for i := range s.Members {
+		if s.Members[i].ID == id {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// Primary returns the name of the primary member, or "" if there is no primary
+func (s *Status) Primary() string {
+	for _, m := range s.Members {
+		if m.StateStr == StatePrimary {
+			return m.Name
+		}
+	}
+	return ""
+}
+
+// Client talks to a MongoDB replica set
+type Client interface {
+	// Status returns the status of the replica set
+	Status(ctx context.Context) (*Status, error)
+
+	// Config returns the configuration of the replica set
+	Config(ctx context.Context) (*Config, error)
+
+	// Initiate initiates the replica set with the configuration
+	Initiate(ctx context.Context, config *Config) error
+
+	// Reconfig replaces the configuration of the replica set.  The version of config must be incremented.
+	Reconfig(ctx context.Context, config *Config) error
+
+	// StepDown makes the primary step down so that a secondary which caught up is elected
+	StepDown(ctx context.Context) error
+
+	// Shards returns the shards registered with a mongos
+	Shards(ctx context.Context) ([]Shard, error)
+
+	// AddShard registers the replica set with a mongos.  shard is the connection string returned by
+	// ConnectionString.
+	AddShard(ctx context.Context, shard string) error
+
+	// Close disconnects the client
+	Close(ctx context.Context) error
+}
+
+// DialFunc connects a Client to the mongod at the given host:port addresses
+type DialFunc func(ctx context.Context, hosts []string) (Client, error)
+
+// Dial connects directly to the host if a single host is given, e.g. to read the status from any member or to
+// initiate the replica set.  Otherwise the replica set is discovered from the hosts and commands are sent to
+// the primary.
+func Dial(ctx context.Context, hosts []string) (Client, error) {
+	opts := options.Client().
+		SetHosts(hosts).
+		SetDirect(len(hosts) == 1).
+		SetConnectTimeout(5 * time.Second).
+		SetServerSelectionTimeout(5 * time.Second)
+	c, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &client{client: c}, nil
+}
+
+type client struct {
+	client *mongo.Client
+}
+
+// Status implements Client
+func (c *client) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	err := c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(status)
+	if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == notYetInitialized {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Initialized = true
+	return status, nil
+}
+
+// Config implements Client
+func (c *client) Config(ctx context.Context) (*Config, error) {
+	result := struct {
+		Config *Config `bson:"config"`
+	}{}
+	err := c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetConfig", Value: 1}}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Config, nil
+}
+
+// Initiate implements Client
+func (c *client) Initiate(ctx context.Context, config *Config) error {
+	return c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: config}}).Err()
+}
+
+// Reconfig implements Client
+func (c *client) Reconfig(ctx context.Context, config *Config) error {
+	return c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetReconfig", Value: config}}).Err()
+}
+
+// StepDown implements Client.  Versions before 4.2 close all connections when stepping down, so only command
+// errors are returned.
+func (c *client) StepDown(ctx context.Context) error {
+	err := c.client.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "replSetStepDown", Value: stepDownSeconds},
+		{Key: "secondaryCatchUpPeriodSecs", Value: stepDownCatchUpSeconds},
+	}).Err()
+	if _, ok := err.(mongo.CommandError); ok {
+		return err
+	}
+	return nil
+}
+
+// Close implements Client
+func (c *client) Close(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
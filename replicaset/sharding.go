@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package replicaset
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Shard is a shard registered with the config servers of a sharded cluster
+type Shard struct {
+	// ID is the name of the shard, which is the name of its replica set
+	ID string `bson:"_id"`
+
+	// Host is the connection string of the shard, e.g. shard-0/foo-0.foo.default.svc:27017
+	Host string `bson:"host"`
+}
+
+// ConnectionString returns the replSetName/host,host form naming the replica set at hosts, used to register
+// shards and to configure the config servers of mongos
+func ConnectionString(replSetName string, hosts []string) string {
+	return replSetName + "/" + strings.Join(hosts, ",")
+}
+
+// Shards implements Client
+func (c *client) Shards(ctx context.Context) ([]Shard, error) {
+	result := struct {
+		Shards []Shard `bson:"shards"`
+	}{}
+	err := c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "listShards", Value: 1}}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	return result.Shards, nil
+}
+
+// AddShard implements Client
+func (c *client) AddShard(ctx context.Context, shard string) error {
+	return c.client.Database("admin").RunCommand(ctx, bson.D{{Key: "addShard", Value: shard}}).Err()
+}
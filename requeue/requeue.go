@@ -0,0 +1,135 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package requeue decides when reconciled objects are reconciled again without a change of the watched objects
+package requeue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// JitterFactor is the maximum fraction of a delay added at random, so that the reconciles of objects failing or
+// resyncing together spread out
+const JitterFactor = 0.1
+
+// Policy contains the requeue delays of the reconciled objects
+type Policy struct {
+	// Progressing is the delay before objects which are not ready yet are reconciled again, so that their status
+	// follows rollouts and membership changes.  Zero disables the requeue.
+	Progressing time.Duration
+
+	// Resync is the delay before ready objects are reconciled again, so that the health of their members is
+	// re-checked.  Zero disables the resync.
+	Resync time.Duration
+
+	// MinBackoff is the delay before a failed reconcile is retried.  It doubles with every consecutive failure of
+	// the object up to MaxBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum delay before a failed reconcile is retried
+	MaxBackoff time.Duration
+}
+
+// Default returns the policy used if none is configured
+func Default() Policy {
+	return Policy{
+		Progressing: 10 * time.Second,
+		Resync:      5 * time.Minute,
+		MinBackoff:  time.Second,
+		MaxBackoff:  5 * time.Minute,
+	}
+}
+
+// Validate returns an error if the delays are negative or the backoff bounds are inverted
+func (p Policy) Validate() error {
+	for name, d := range map[string]time.Duration{
+		"progressing": p.Progressing, "resync": p.Resync, "min backoff": p.MinBackoff, "max backoff": p.MaxBackoff,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s delay %s is negative", name, d)
+		}
+	}
+	if p.MinBackoff <= 0 {
+		return fmt.Errorf("min backoff %s must be positive", p.MinBackoff)
+	}
+	if p.MaxBackoff < p.MinBackoff {
+		return fmt.Errorf("max backoff %s is less than min backoff %s", p.MaxBackoff, p.MinBackoff)
+	}
+	return nil
+}
+
+// Backoff returns the delay before a reconcile is retried after the given number of consecutive failures,
+// without jitter
+func (p Policy) Backoff(failures int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < failures && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// Tracker returns the results of reconciles following a Policy.  It counts the consecutive failures of each
+// object and is safe for concurrent reconciles.
+type Tracker struct {
+	policy Policy
+
+	mu       sync.Mutex
+	failures map[types.NamespacedName]int
+}
+
+// NewTracker returns a Tracker following the policy
+func NewTracker(policy Policy) *Tracker {
+	return &Tracker{policy: policy, failures: map[types.NamespacedName]int{}}
+}
+
+// Succeeded resets the failures of the object and returns the result of a successful reconcile.  Objects which are
+// ready are resynced, others are requeued sooner.
+func (t *Tracker) Succeeded(key types.NamespacedName, ready bool) reconcile.Result {
+	t.Forget(key)
+	d := t.policy.Progressing
+	if ready {
+		d = t.policy.Resync
+	}
+	if d == 0 {
+		return reconcile.Result{}
+	}
+	return reconcile.Result{RequeueAfter: wait.Jitter(d, JitterFactor)}
+}
+
+// Failed counts a failure of the object and returns the result retrying the reconcile after the backoff
+func (t *Tracker) Failed(key types.NamespacedName) reconcile.Result {
+	t.mu.Lock()
+	t.failures[key]++
+	failures := t.failures[key]
+	t.mu.Unlock()
+	return reconcile.Result{RequeueAfter: wait.Jitter(t.policy.Backoff(failures), JitterFactor)}
+}
+
+// Forget resets the failures of the object, e.g. once it is deleted
+func (t *Tracker) Forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, key)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requeue
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// within returns a matcher for a delay jittered from d
+func within(d time.Duration) OmegaMatcher {
+	return SatisfyAll(
+		BeNumerically(">=", d),
+		BeNumerically("<=", time.Duration(float64(d)*(1+JitterFactor))),
+	)
+}
+
+var _ = Describe("Policy", func() {
+	It("should double the backoff up to the maximum", func() {
+		p := Policy{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+		Expect(p.Backoff(1)).To(Equal(time.Second))
+		Expect(p.Backoff(2)).To(Equal(2 * time.Second))
+		Expect(p.Backoff(4)).To(Equal(8 * time.Second))
+		Expect(p.Backoff(5)).To(Equal(10 * time.Second))
+		Expect(p.Backoff(1000)).To(Equal(10 * time.Second))
+	})
+
+	It("should reject invalid delays", func() {
+		Expect(Default().Validate()).To(Succeed())
+
+		p := Default()
+		p.Resync = -time.Second
+		Expect(p.Validate()).NotTo(Succeed())
+
+		p = Default()
+		p.MaxBackoff = p.MinBackoff / 2
+		Expect(p.Validate()).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Tracker", func() {
+	key := types.NamespacedName{Namespace: "default", Name: "foo"}
+	var t *Tracker
+
+	BeforeEach(func() {
+		t = NewTracker(Default())
+	})
+
+	It("should requeue objects which are not ready sooner than ready ones", func() {
+		Expect(t.Succeeded(key, false).RequeueAfter).To(within(Default().Progressing))
+		Expect(t.Succeeded(key, true).RequeueAfter).To(within(Default().Resync))
+	})
+
+	It("should not requeue if the delay is disabled", func() {
+		t = NewTracker(Policy{MinBackoff: time.Second, MaxBackoff: time.Second})
+
+		Expect(t.Succeeded(key, false).RequeueAfter).To(BeZero())
+		Expect(t.Succeeded(key, true).RequeueAfter).To(BeZero())
+	})
+
+	It("should back off until the object succeeds", func() {
+		Expect(t.Failed(key).RequeueAfter).To(within(time.Second))
+		Expect(t.Failed(key).RequeueAfter).To(within(2 * time.Second))
+		Expect(t.Failed(types.NamespacedName{Namespace: "default", Name: "bar"}).RequeueAfter).To(within(time.Second))
+		Expect(t.Failed(key).RequeueAfter).To(within(4 * time.Second))
+
+		t.Succeeded(key, true)
+		Expect(t.Failed(key).RequeueAfter).To(within(time.Second))
+	})
+})
@@ -0,0 +1,105 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CheckAdoptable returns an error if the existing StatefulSet cannot be taken over without data loss.  The
+// mongo container must store its data on a volume claim template and use the replica set name of the operator.
+func CheckAdoptable(ss *appsv1.StatefulSet) error {
+	var mongo *corev1.Container
+	for i := range ss.Spec.Template.Spec.Containers {
+		if c := &ss.Spec.Template.Spec.Containers[i]; c.Name == "mongo" {
+			mongo = c
+		}
+	}
+	if mongo == nil {
+		return fmt.Errorf("StatefulSet %s has no mongo container", ss.Name)
+	}
+	if dataClaimTemplate(ss) == "" {
+		return fmt.Errorf("StatefulSet %s does not store %s on a volume claim template", ss.Name, dataDir)
+	}
+	args := append(append([]string{}, mongo.Command...), mongo.Args...)
+	for i, arg := range args {
+		replSet := ""
+		switch {
+		case strings.HasPrefix(arg, "--replSet="):
+			replSet = strings.TrimPrefix(arg, "--replSet=")
+		case arg == "--replSet" && i+1 < len(args):
+			replSet = args[i+1]
+		default:
+			continue
+		}
+		if replSet != ReplicaSetName {
+			return fmt.Errorf("StatefulSet %s runs replica set %q, only %q can be adopted", ss.Name, replSet, ReplicaSetName)
+		}
+	}
+	return nil
+}
+
+// KeepAdoptedFields keeps the fields of the adopted StatefulSet which cannot be changed, so that the generated
+// StatefulSet can be applied to it.  The Pod template keeps the labels selected by the existing selector and
+// mounts the existing data claim template.
+func KeepAdoptedFields(ss, adopted *appsv1.StatefulSet) {
+	ss.Spec.Selector = adopted.Spec.Selector.DeepCopy()
+	ss.Spec.ServiceName = adopted.Spec.ServiceName
+	ss.Spec.PodManagementPolicy = adopted.Spec.PodManagementPolicy
+	ss.Spec.VolumeClaimTemplates = adopted.Spec.VolumeClaimTemplates
+
+	if ss.Spec.Template.Labels == nil {
+		ss.Spec.Template.Labels = map[string]string{}
+	}
+	for k, v := range adopted.Spec.Selector.MatchLabels {
+		ss.Spec.Template.Labels[k] = v
+	}
+
+	claim := dataClaimTemplate(adopted)
+	for i := range ss.Spec.Template.Spec.Containers {
+		c := &ss.Spec.Template.Spec.Containers[i]
+		for j := range c.VolumeMounts {
+			if c.VolumeMounts[j].MountPath == dataDir {
+				c.VolumeMounts[j].Name = claim
+			}
+		}
+	}
+}
+
+// dataClaimTemplate returns the name of the volume claim template mounted at the data directory of the
+// mongo container, or "" if the data is not stored on a claim
+func dataClaimTemplate(ss *appsv1.StatefulSet) string {
+	claims := map[string]bool{}
+	for _, pvc := range ss.Spec.VolumeClaimTemplates {
+		claims[pvc.Name] = true
+	}
+	for _, c := range ss.Spec.Template.Spec.Containers {
+		if c.Name != "mongo" {
+			continue
+		}
+		for _, m := range c.VolumeMounts {
+			if m.MountPath == dataDir && claims[m.Name] {
+				return m.Name
+			}
+		}
+	}
+	return ""
+}
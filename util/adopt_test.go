@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Adoption", func() {
+	var existing *appsv1.StatefulSet
+
+	BeforeEach(func() {
+		// A StatefulSet as created by hand before the operator existed
+		existing = &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "mongo", Namespace: "default"},
+			Spec: appsv1.StatefulSetSpec{
+				ServiceName: "mongo",
+				Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"role": "mongo"}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"role": "mongo", "environment": "test"}},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:         "mongo",
+							Image:        "mongo",
+							Command:      []string{"mongod", "--replSet", "rs0", "--bind_ip", "0.0.0.0"},
+							VolumeMounts: []corev1.VolumeMount{{Name: "mongo-data", MountPath: "/data/db"}},
+						}},
+					},
+				},
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "mongo-data"}}},
+			},
+		}
+	})
+
+	It("should accept a compatible StatefulSet", func() {
+		Expect(CheckAdoptable(existing)).To(Succeed())
+	})
+
+	It("should reject a different replica set name", func() {
+		existing.Spec.Template.Spec.Containers[0].Command[2] = "other"
+		Expect(CheckAdoptable(existing)).NotTo(Succeed())
+	})
+
+	It("should reject data not stored on a claim", func() {
+		existing.Spec.VolumeClaimTemplates = nil
+		Expect(CheckAdoptable(existing)).NotTo(Succeed())
+	})
+
+	It("should keep the immutable fields and the data claim", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "mongo"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		ss := existing.DeepCopy()
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, nil, operatorconfig.Default())
+		KeepAdoptedFields(ss, existing)
+
+		Expect(ss.Spec.Selector).To(Equal(existing.Spec.Selector))
+		Expect(ss.Spec.VolumeClaimTemplates).To(Equal(existing.Spec.VolumeClaimTemplates))
+		Expect(ss.Spec.Template.Labels).To(HaveKeyWithValue("role", "mongo"))
+		Expect(ss.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "mongo-data", MountPath: "/data/db"}))
+		Expect(ValidateStatefulSet(ss)).To(Succeed())
+	})
+})
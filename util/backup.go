@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// finalBackupDir is where the final backup PersistentVolumeClaim is mounted
+const finalBackupDir = "/backup"
+
+// FinalBackupArchive returns the name of the archive the final backup of the MongoDB is written to.  It
+// is derived from the deletion timestamp so that it is stable across reconciles.
+func FinalBackupArchive(mongo metav1.Object) string {
+	ts := ""
+	if t := mongo.GetDeletionTimestamp(); t != nil {
+		ts = "-" + t.UTC().Format("20060102T150405Z")
+	}
+	return fmt.Sprintf("%s-%s%s.archive.gz", mongo.GetNamespace(), mongo.GetName(), ts)
+}
+
+// SetFinalBackupJobFields sets fields on the Job running mongodump against the Service before the data is deleted
+// backup: the final backup configuration from the MongoDB spec
+// image: the image running mongodump if the spec does not set one
+func SetFinalBackupJobFields(job *batchv1.Job, service *corev1.Service, mongo metav1.Object, backup *v1alpha1.FinalBackupSpec, image string) {
+	if backup.Image != "" {
+		image = backup.Image
+	}
+	backoffLimit := int32(2)
+
+	job.Labels = Labels(mongo, ComponentBackup)
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.Template = corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: SelectorLabels(mongo, ComponentBackup)},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{
+					Name:  "mongodump",
+					Image: image,
+					Command: []string{
+						"mongodump",
+						fmt.Sprintf("--host=%s.%s.svc:27017", service.Name, service.Namespace),
+						"--gzip",
+						fmt.Sprintf("--archive=%s/%s", finalBackupDir, FinalBackupArchive(mongo)),
+					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "backup", MountPath: finalBackupDir}},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "backup",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: backup.ClaimName},
+					},
+				},
+			},
+		},
+	}
+}
+
+// IsMemberClaim returns true if the PersistentVolumeClaim was created from a volume claim template of the
+// StatefulSet, i.e. it is named <template>-<statefulset>-<ordinal>
+func IsMemberClaim(ss *appsv1.StatefulSet, claim string) bool {
+	for _, template := range ss.Spec.VolumeClaimTemplates {
+		prefix := template.Name + "-" + ss.Name + "-"
+		if !strings.HasPrefix(claim, prefix) {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimPrefix(claim, prefix), 10, 32); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOwnedSecret returns true if the Secret belongs to the MongoDB, i.e. it is controlled by the MongoDB or carries
+// its selector labels.  Other Secrets, e.g. referenced by the podTemplate but shared with other workloads, are
+// owned by the user.
+func IsOwnedSecret(secret *corev1.Secret, mongo *v1alpha1.MongoDB) bool {
+	if metav1.IsControlledBy(secret, mongo) {
+		return true
+	}
+	selector := componentSelector(mongo, ComponentReplicaSet, ComponentArbiter, ComponentHidden, ComponentDelayed, ComponentBackup)
+	s, err := metav1.LabelSelectorAsSelector(&selector)
+	return err == nil && s.Matches(labels.Set(secret.Labels))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SetFinalBackupJobFields", func() {
+	It("should dump the MongoDB into the claim", func() {
+		deleted := metav1.NewTime(time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC))
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", DeletionTimestamp: &deleted}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service", Namespace: "default"}}
+		job := &batchv1.Job{}
+		SetFinalBackupJobFields(job, service, mongo, &v1alpha1.FinalBackupSpec{ClaimName: "backups"}, "mongo:4.0")
+
+		pod := job.Spec.Template.Spec
+		Expect(pod.Containers[0].Image).To(Equal("mongo:4.0"))
+		Expect(pod.Containers[0].Command).To(ContainElement("--host=foo-mongodb-service.default.svc:27017"))
+		Expect(pod.Containers[0].Command).To(ContainElement("--archive=/backup/default-foo-20190601T123000Z.archive.gz"))
+		Expect(pod.Volumes[0].PersistentVolumeClaim.ClaimName).To(Equal("backups"))
+	})
+})
+
+var _ = Describe("IsMemberClaim", func() {
+	It("should only match the claims of the StatefulSet", func() {
+		bar := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"}}
+		fooBar := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo-bar", Namespace: "default"}}
+		replicas := int32(3)
+		ss := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "bar-mongodb-statefulset", Namespace: "default"}}
+		SetStatefulSetFields(ss, &corev1.Service{}, &corev1.ConfigMap{}, bar, &replicas, nil, operatorconfig.Default())
+
+		Expect(IsMemberClaim(ss, DataVolume+"-bar-mongodb-statefulset-0")).To(BeTrue())
+		Expect(IsMemberClaim(ss, DataVolume+"-bar-mongodb-statefulset-12")).To(BeTrue())
+		Expect(IsMemberClaim(ss, DataVolume+"-"+fooBar.Name+"-mongodb-statefulset-0")).To(BeFalse())
+		Expect(IsMemberClaim(ss, "other-bar-mongodb-statefulset-0")).To(BeFalse())
+		Expect(IsMemberClaim(ss, DataVolume+"-bar-mongodb-statefulset-backup")).To(BeFalse())
+	})
+})
+
+var _ = Describe("IsOwnedSecret", func() {
+	mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "uid"}}
+
+	It("should only own the Secrets controlled by or labeled for the MongoDB", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "default"}}
+		Expect(IsOwnedSecret(secret, mongo)).To(BeFalse())
+
+		controlled := secret.DeepCopy()
+		controller := true
+		controlled.OwnerReferences = []metav1.OwnerReference{{Name: "foo", UID: "uid", Controller: &controller}}
+		Expect(IsOwnedSecret(controlled, mongo)).To(BeTrue())
+
+		labeled := secret.DeepCopy()
+		labeled.Labels = SelectorLabels(mongo, ComponentReplicaSet)
+		Expect(IsOwnedSecret(labeled, mongo)).To(BeTrue())
+
+		other := secret.DeepCopy()
+		other.Labels = SelectorLabels(&v1alpha1.MongoDBShardedCluster{ObjectMeta: mongo.ObjectMeta}, ComponentMongos)
+		Expect(IsOwnedSecret(other, mongo)).To(BeFalse())
+	})
+})
@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// MongodConfigKey is the key of the mongod configuration file in the generated ConfigMap
+	MongodConfigKey = "mongod.conf"
+
+	// ReplicaSetName is the name of the replica set run by the members
+	ReplicaSetName = "rs0"
+
+	// ConfigHashAnnotation is set on the Pod template to the hash of the mongod configuration so that
+	// configuration changes trigger a rolling restart
+	ConfigHashAnnotation = "databases.example.com/config-hash"
+
+	mongodConfigVolume = "mongod-config"
+	mongodConfigDir    = "/etc/mongod"
+
+	// dataDir is where mongod stores its data
+	dataDir = "/data/db"
+
+	// DataVolume is the name of the volume claim template holding the data of the members
+	DataVolume = "mongo-persistent-storage"
+)
+
+// operatorOwnedMongodConfigKeys are set by the operator and may not be overridden
+var operatorOwnedMongodConfigKeys = []string{
+	"net.port",
+	"net.bindIp",
+	"net.bindIpAll",
+	"replication.replSetName",
+	"sharding.clusterRole",
+	"storage.dbPath",
+	"processManagement.fork",
+	"processManagement.pidFilePath",
+	"systemLog.destination",
+	"systemLog.path",
+}
+
+// invalidMongodConfigKeys are rejected by supported versions of mongod
+var invalidMongodConfigKeys = []string{
+	"storage.mmapv1",
+	"net.http",
+	"replication.secondaryIndexPrefetch",
+}
+
+// MongodConfig returns the mongod.conf contents for the MongoDB instance.  additional is merged on top of
+// the configuration owned by the operator.  An error is returned if additional sets operator owned or invalid keys.
+func MongodConfig(additional *runtime.RawExtension) (string, error) {
+	return ReplicaSetMongodConfig(ReplicaSetName, "", additional)
+}
+
+// StandaloneMongodConfig returns the mongod.conf contents for a standalone MongoDB instance, which does not
+// configure replication
+func StandaloneMongodConfig(additional *runtime.RawExtension) (string, error) {
+	return ReplicaSetMongodConfig("", "", additional)
+}
+
+// ReplicaSetMongodConfig returns the mongod.conf contents for the members of the replica set replSetName, or for
+// a standalone mongod if replSetName is "".  clusterRole is the role of the replica set in a sharded cluster,
+// configsvr or shardsvr, or "" for a replica set which is not sharded.
+func ReplicaSetMongodConfig(replSetName, clusterRole string, additional *runtime.RawExtension) (string, error) {
+	config := map[string]interface{}{
+		"net": map[string]interface{}{
+			"port":      27017,
+			"bindIpAll": true,
+		},
+		"storage": map[string]interface{}{
+			"dbPath": dataDir,
+		},
+	}
+	if replSetName != "" {
+		config["replication"] = map[string]interface{}{"replSetName": replSetName}
+	}
+	if clusterRole != "" {
+		config["sharding"] = map[string]interface{}{"clusterRole": clusterRole}
+	}
+
+	if additional != nil && len(additional.Raw) > 0 {
+		extra := map[string]interface{}{}
+		if err := json.Unmarshal(additional.Raw, &extra); err != nil {
+			return "", fmt.Errorf("additionalMongodConfig must be an object: %v", err)
+		}
+		for _, key := range flattenKeys("", extra) {
+			for _, owned := range operatorOwnedMongodConfigKeys {
+				if hasKeyPrefix(key, owned) {
+					return "", fmt.Errorf("additionalMongodConfig: %s is managed by the operator", key)
+				}
+			}
+			for _, invalid := range invalidMongodConfigKeys {
+				if hasKeyPrefix(key, invalid) {
+					return "", fmt.Errorf("additionalMongodConfig: %s is not supported by mongod", key)
+				}
+			}
+		}
+		mergeMaps(config, extra)
+	}
+
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// SetConfigMapFields sets fields on the ConfigMap containing the mongod configuration
+func SetConfigMapFields(cm *corev1.ConfigMap, mongo metav1.Object, config string) {
+	SetComponentConfigMapFields(cm, mongo, ComponentReplicaSet, config)
+}
+
+// SetComponentConfigMapFields sets fields on the ConfigMap containing the mongod configuration of the component
+func SetComponentConfigMapFields(cm *corev1.ConfigMap, instance metav1.Object, component, config string) {
+	cm.Labels = Labels(instance, component)
+	cm.Data = map[string]string{MongodConfigKey: config}
+}
+
+// ConfigHash returns a hash of the data so that changes can be detected
+func ConfigHash(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, data[k])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// flattenKeys returns the dotted paths of all leaves in m
+func flattenKeys(prefix string, m map[string]interface{}) []string {
+	var keys []string
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		keys = append(keys, key)
+		if child, ok := v.(map[string]interface{}); ok {
+			keys = append(keys, flattenKeys(key, child)...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hasKeyPrefix returns true if key is prefix or is nested under prefix
+func hasKeyPrefix(key, prefix string) bool {
+	return key == prefix || strings.HasPrefix(key, prefix+".")
+}
+
+// mergeMaps recursively merges src into dst
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcChild, srcOK := v.(map[string]interface{})
+		dstChild, dstOK := dst[k].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeMaps(dstChild, srcChild)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// copyLabels returns a copy of the labels on obj
+func copyLabels(obj metav1.Object) map[string]string {
+	labels := map[string]string{}
+	for k, v := range obj.GetLabels() {
+		labels[k] = v
+	}
+	return labels
+}
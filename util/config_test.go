@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("MongodConfig", func() {
+	It("should render the operator owned configuration", func() {
+		config, err := MongodConfig(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(ContainSubstring("replSetName: rs0"))
+		Expect(config).To(ContainSubstring("bindIpAll: true"))
+	})
+
+	It("should merge additional configuration", func() {
+		config, err := MongodConfig(&runtime.RawExtension{
+			Raw: []byte(`{"net":{"maxIncomingConnections":100},"operationProfiling":{"mode":"slowOp"}}`),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(ContainSubstring("maxIncomingConnections: 100"))
+		Expect(config).To(ContainSubstring("mode: slowOp"))
+		Expect(config).To(ContainSubstring("port: 27017"))
+	})
+
+	It("should reject operator owned keys", func() {
+		_, err := MongodConfig(&runtime.RawExtension{Raw: []byte(`{"replication":{"replSetName":"other"}}`)})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should render the role of a sharded cluster replica set", func() {
+		config, err := ReplicaSetMongodConfig("shard-0", "shardsvr", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(ContainSubstring("replSetName: shard-0"))
+		Expect(config).To(ContainSubstring("clusterRole: shardsvr"))
+
+		config, err = MongodConfig(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).NotTo(ContainSubstring("sharding"))
+	})
+
+	It("should not configure replication for standalone instances", func() {
+		config, err := StandaloneMongodConfig(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).NotTo(ContainSubstring("replication"))
+		Expect(config).To(ContainSubstring("dbPath: /data/db"))
+	})
+
+	It("should reject invalid keys", func() {
+		_, err := MongodConfig(&runtime.RawExtension{Raw: []byte(`{"storage":{"mmapv1":{"smallFiles":true}}}`)})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should change the hash when the configuration changes", func() {
+		Expect(ConfigHash(map[string]string{MongodConfigKey: "a"})).
+			NotTo(Equal(ConfigHash(map[string]string{MongodConfigKey: "b"})))
+	})
+})
@@ -0,0 +1,151 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// AppliedHashAnnotation is set on the generated objects to a hash of the fields applied by the operator, so that
+// changes made by others can be told apart from changes of the MongoDB
+const AppliedHashAnnotation = "databases.example.com/applied-hash"
+
+// AppliedHash returns a hash of the fields set on the generated object
+func AppliedHash(obj runtime.Object) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// Drift returns the sorted paths of the fields set on the generated object which have a different value on the
+// live object.  Fields only set on the live object, e.g. defaults or fields set by others, are ignored, as are
+// the status and all metadata but the labels and annotations.  The items of lists merged by key, e.g. containers,
+// are compared by key so that items added by others are ignored as well.
+func Drift(generated, live runtime.Object) ([]string, error) {
+	g, err := toUnstructured(generated)
+	if err != nil {
+		return nil, err
+	}
+	l, err := toUnstructured(live)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for k, v := range g {
+		switch k {
+		case "apiVersion", "kind", "status":
+		case "metadata":
+			m, _ := v.(map[string]interface{})
+			lm, _ := l[k].(map[string]interface{})
+			for _, field := range []string{"labels", "annotations"} {
+				diffFields("metadata."+field, m[field], lm[field], &paths)
+			}
+		default:
+			diffFields(k, v, l[k], &paths)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// toUnstructured returns the fields of the typed or unstructured object
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		return u.UnstructuredContent(), nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+// diffFields appends the paths below path of the fields set in generated which differ in live
+func diffFields(path string, generated, live interface{}, paths *[]string) {
+	switch g := generated.(type) {
+	case nil:
+	case map[string]interface{}:
+		l, _ := live.(map[string]interface{})
+		for k, v := range g {
+			diffFields(path+"."+k, v, l[k], paths)
+		}
+	case []interface{}:
+		l, _ := live.([]interface{})
+		if key := mergeKey(g); key != "" {
+			// Items added by others, e.g. injected sidecars, are not drift
+			for i := range g {
+				item := findItem(l, key, g[i])
+				if item == nil {
+					*paths = append(*paths, fmt.Sprintf("%s[%d]", path, i))
+					continue
+				}
+				diffFields(fmt.Sprintf("%s[%d]", path, i), g[i], item, paths)
+			}
+			return
+		}
+		if len(l) != len(g) {
+			*paths = append(*paths, path)
+			return
+		}
+		for i := range g {
+			diffFields(fmt.Sprintf("%s[%d]", path, i), g[i], l[i], paths)
+		}
+	default:
+		if !reflect.DeepEqual(generated, live) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+// mergeKeys are the fields identifying the items of the lists merged by the API server, in the order they are
+// looked for
+var mergeKeys = []string{"name", "containerPort", "port", "mountPath", "devicePath", "ip"}
+
+// mergeKey returns the field which identifies each of the items, or "" if the list is replaced as a whole
+func mergeKey(items []interface{}) string {
+	for _, key := range mergeKeys {
+		values := map[string]bool{}
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			v, ok := m[key]
+			if !ok || values[fmt.Sprint(v)] {
+				break
+			}
+			values[fmt.Sprint(v)] = true
+		}
+		if len(items) > 0 && len(values) == len(items) {
+			return key
+		}
+	}
+	return ""
+}
+
+// findItem returns the item of items with the same value of the key as item, or nil if there is none
+func findItem(items []interface{}, key string, item interface{}) interface{} {
+	want := item.(map[string]interface{})[key]
+	for _, i := range items {
+		if m, ok := i.(map[string]interface{}); ok && reflect.DeepEqual(m[key], want) {
+			return i
+		}
+	}
+	return nil
+}
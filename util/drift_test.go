@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Drift", func() {
+	var generated, live *appsv1.StatefulSet
+
+	BeforeEach(func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		replicas := int32(3)
+		generated = &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-statefulset", Namespace: "default"}}
+		SetStatefulSetFields(generated, &corev1.Service{}, &corev1.ConfigMap{}, mongo, &replicas, nil, operatorconfig.Default())
+
+		// The live object is defaulted and has metadata and a status set by the API server
+		live = generated.DeepCopy()
+		live.ResourceVersion = "42"
+		live.Spec.RevisionHistoryLimit = new(int32)
+		live.Spec.Template.Spec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+		live.Status.Replicas = 3
+	})
+
+	It("should ignore defaults, metadata and status", func() {
+		Expect(Drift(generated, live)).To(BeEmpty())
+	})
+
+	It("should report the changed fields", func() {
+		replicas := int32(5)
+		live.Spec.Replicas = &replicas
+		live.Spec.Template.Spec.Containers[0].Image = "mongo:latest"
+		live.Labels["foo"] = "bar"
+
+		Expect(Drift(generated, live)).To(Equal([]string{
+			"spec.replicas",
+			"spec.template.spec.containers[0].image",
+		}))
+	})
+
+	It("should report changed labels", func() {
+		live.Labels[LabelInstance] = "bar"
+
+		Expect(Drift(generated, live)).To(Equal([]string{"metadata.labels." + LabelInstance}))
+	})
+
+	It("should ignore list items added by others", func() {
+		live.Spec.Template.Spec.Containers = append([]corev1.Container{{Name: "sidecar"}}, live.Spec.Template.Spec.Containers...)
+		live.Spec.Template.Spec.Volumes = append(live.Spec.Template.Spec.Volumes, corev1.Volume{Name: "injected"})
+		live.Spec.Template.Spec.Containers[1].VolumeMounts = append(live.Spec.Template.Spec.Containers[1].VolumeMounts,
+			corev1.VolumeMount{Name: "injected", MountPath: "/injected"})
+
+		Expect(Drift(generated, live)).To(BeEmpty())
+	})
+
+	It("should report removed and changed list items by their key", func() {
+		live.Spec.Template.Spec.Containers = append([]corev1.Container{{Name: "sidecar"}}, live.Spec.Template.Spec.Containers...)
+		live.Spec.Template.Spec.Containers[1].Image = "mongo:latest"
+		live.Spec.Template.Spec.Volumes = nil
+
+		Expect(Drift(generated, live)).To(Equal([]string{
+			"spec.template.spec.containers[0].image",
+			"spec.template.spec.volumes[0]",
+		}))
+	})
+
+	It("should report changed lists without a key", func() {
+		live.Spec.Template.Spec.Containers[0].Command = append(live.Spec.Template.Spec.Containers[0].Command, "--quiet")
+
+		Expect(Drift(generated, live)).To(Equal([]string{"spec.template.spec.containers[0].command"}))
+	})
+})
+
+var _ = Describe("AppliedHash", func() {
+	It("should only change with the generated fields", func() {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+		hash, err := AppliedHash(service)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(AppliedHash(service.DeepCopy())).To(Equal(hash))
+
+		service.Spec.ClusterIP = "None"
+		Expect(AppliedHash(service)).NotTo(Equal(hash))
+	})
+})
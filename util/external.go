@@ -0,0 +1,104 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// LabelPodName is set by the StatefulSet controller on its Pods to their name
+const LabelPodName = "statefulset.kubernetes.io/pod-name"
+
+// ExternalServiceName returns the name of the Service exposing the member running in the Pod outside the cluster
+func ExternalServiceName(pod string) string {
+	return pod + "-external"
+}
+
+// SetExternalServiceFields sets fields on the Service exposing the member running in the Pod of the component
+// outside the cluster.  The node port is left to the API server, which keeps the assigned one as it is not part
+// of the applied fields.
+func SetExternalServiceFields(service *corev1.Service, mongo metav1.Object, component, pod string, spec *v1alpha1.ExternalAccessSpec) {
+	service.Labels = Labels(mongo, ComponentExternal)
+	for k, v := range spec.Annotations {
+		if service.Annotations == nil {
+			service.Annotations = map[string]string{}
+		}
+		service.Annotations[k] = v
+	}
+
+	service.Spec.Type = spec.Type
+	service.Spec.Ports = []corev1.ServicePort{
+		{Name: "mongodb", Port: 27017, TargetPort: intstr.IntOrString{IntVal: 27017, Type: intstr.Int}},
+	}
+	service.Spec.Selector = SelectorLabels(mongo, component)
+	service.Spec.Selector[LabelPodName] = pod
+}
+
+// ExternalAddress returns the address at which clients outside the cluster reach the member exposed by the
+// Service, or "" if it is not assigned yet.  nodeAddress is the address of the node running the member, only used
+// for NodePort Services.
+func ExternalAddress(service *corev1.Service, nodeAddress string) string {
+	if len(service.Spec.Ports) == 0 {
+		return ""
+	}
+	switch service.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.Hostname != "" {
+				return net.JoinHostPort(ingress.Hostname, strconv.Itoa(int(service.Spec.Ports[0].Port)))
+			}
+			if ingress.IP != "" {
+				return net.JoinHostPort(ingress.IP, strconv.Itoa(int(service.Spec.Ports[0].Port)))
+			}
+		}
+	case corev1.ServiceTypeNodePort:
+		if nodeAddress != "" && service.Spec.Ports[0].NodePort != 0 {
+			return net.JoinHostPort(nodeAddress, strconv.Itoa(int(service.Spec.Ports[0].NodePort)))
+		}
+	}
+	return ""
+}
+
+// NodeAddress returns the external IP of the node, or its internal IP if it has none
+func NodeAddress(node *corev1.Node) string {
+	for _, t := range []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP} {
+		for _, a := range node.Status.Addresses {
+			if a.Type == t && a.Address != "" {
+				return a.Address
+			}
+		}
+	}
+	return ""
+}
+
+// ExternalConnectionString returns the connection string of the members at the external addresses.  replSetName
+// is "" for a standalone MongoDB.
+func ExternalConnectionString(addresses []string, replSetName string) string {
+	s := fmt.Sprintf("mongodb://%s/", strings.Join(addresses, ","))
+	if replSetName != "" {
+		s += "?replicaSet=" + replSetName
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SetExternalServiceFields", func() {
+	mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+
+	It("should select the Pod of the member", func() {
+		service := &corev1.Service{}
+		spec := &v1alpha1.ExternalAccessSpec{Type: corev1.ServiceTypeLoadBalancer, Annotations: map[string]string{"a": "b"}}
+		SetExternalServiceFields(service, mongo, ComponentReplicaSet, "foo-mongodb-0", spec)
+
+		Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeLoadBalancer))
+		Expect(service.Annotations).To(HaveKeyWithValue("a", "b"))
+		Expect(service.Labels).To(HaveKeyWithValue(LabelComponent, ComponentExternal))
+		Expect(service.Spec.Selector).To(HaveKeyWithValue(LabelComponent, ComponentReplicaSet))
+		Expect(service.Spec.Selector).To(HaveKeyWithValue(LabelPodName, "foo-mongodb-0"))
+	})
+})
+
+var _ = Describe("ExternalAddress", func() {
+	It("should use the load balancer ingress", func() {
+		service := &corev1.Service{Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 27017}},
+		}}
+		Expect(ExternalAddress(service, "")).To(BeEmpty())
+
+		service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+		Expect(ExternalAddress(service, "")).To(Equal("10.0.0.1:27017"))
+	})
+
+	It("should use the node address and port", func() {
+		service := &corev1.Service{Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{{Port: 27017, NodePort: 30017}},
+		}}
+		Expect(ExternalAddress(service, "")).To(BeEmpty())
+
+		node := &corev1.Node{Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "192.168.0.1"},
+			{Type: corev1.NodeExternalIP, Address: "1.2.3.4"},
+		}}}
+		Expect(ExternalAddress(service, NodeAddress(node))).To(Equal("1.2.3.4:30017"))
+	})
+})
+
+var _ = Describe("ExternalConnectionString", func() {
+	It("should name the replica set", func() {
+		Expect(ExternalConnectionString([]string{"10.0.0.1:27017", "10.0.0.2:27017"}, "rs0")).
+			To(Equal("mongodb://10.0.0.1:27017,10.0.0.2:27017/?replicaSet=rs0"))
+		Expect(ExternalConnectionString([]string{"10.0.0.1:27017"}, "")).To(Equal("mongodb://10.0.0.1:27017/"))
+	})
+})
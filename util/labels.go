@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Standard labels set on all generated objects, see
+// https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
+const (
+	LabelName      = "app.kubernetes.io/name"
+	LabelInstance  = "app.kubernetes.io/instance"
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	LabelComponent = "app.kubernetes.io/component"
+
+	// AppName is the value of the name label
+	AppName = "mongodb"
+
+	// ManagedBy is the value of the managed-by label
+	ManagedBy = "kubebuilder-workshop"
+)
+
+// Values of the component label.  Each kind of resource managed by the operator uses its own components so that
+// the selectors of instances of different kinds with the same name do not overlap.
+const (
+	// ComponentReplicaSet are the members of a MongoDB replica set
+	ComponentReplicaSet = "replicaset"
+
+	// ComponentArbiter are the arbiters of a MongoDB replica set
+	ComponentArbiter = "arbiter"
+
+	// ComponentHidden are the hidden members of a MongoDB replica set
+	ComponentHidden = "hidden"
+
+	// ComponentDelayed are the delayed members of a MongoDB replica set
+	ComponentDelayed = "delayed"
+
+	// ComponentConfigServer are the config servers of a MongoDBShardedCluster
+	ComponentConfigServer = "configsvr"
+
+	// ComponentMongos are the query routers of a MongoDBShardedCluster
+	ComponentMongos = "mongos"
+
+	// ComponentBackup is the final backup of a MongoDB
+	ComponentBackup = "backup"
+
+	// ComponentExternal are the Services exposing the members of a MongoDB outside the cluster
+	ComponentExternal = "external"
+)
+
+// ShardComponent returns the component of the shard with the given index of a MongoDBShardedCluster, which is
+// also the name of the replica set of the shard
+func ShardComponent(index int) string {
+	return fmt.Sprintf("shard-%d", index)
+}
+
+// SelectorLabels returns the labels selecting the Pods of the component of the instance
+func SelectorLabels(instance metav1.Object, component string) map[string]string {
+	return map[string]string{
+		LabelName:      AppName,
+		LabelInstance:  instance.GetName(),
+		LabelManagedBy: ManagedBy,
+		LabelComponent: component,
+	}
+}
+
+// Labels returns the labels of the objects generated for the component of the instance: the labels of the
+// instance and the standard labels, which take precedence
+func Labels(instance metav1.Object, component string) map[string]string {
+	labels := copyLabels(instance)
+	for k, v := range SelectorLabels(instance, component) {
+		labels[k] = v
+	}
+	return labels
+}
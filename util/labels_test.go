@@ -0,0 +1,64 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("Labels", func() {
+	var mongo *v1alpha1.MongoDB
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+			Labels:    map[string]string{"team": "db", LabelComponent: "custom"},
+		}}
+	})
+
+	It("should select the Pods of the component by the standard labels", func() {
+		Expect(SelectorLabels(mongo, ComponentReplicaSet)).To(Equal(map[string]string{
+			LabelName:      AppName,
+			LabelInstance:  "foo",
+			LabelManagedBy: ManagedBy,
+			LabelComponent: ComponentReplicaSet,
+		}))
+	})
+
+	It("should not select the Pods of other components or instances", func() {
+		selector := labels.SelectorFromSet(SelectorLabels(mongo, ComponentReplicaSet))
+		Expect(selector.Matches(labels.Set(SelectorLabels(mongo, ComponentArbiter)))).To(BeFalse())
+
+		other := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"}}
+		Expect(selector.Matches(labels.Set(SelectorLabels(other, ComponentReplicaSet)))).To(BeFalse())
+		Expect(ShardComponent(0)).NotTo(Equal(ShardComponent(1)))
+	})
+
+	It("should add the labels of the instance without overriding the standard labels", func() {
+		l := Labels(mongo, ComponentReplicaSet)
+		Expect(l).To(HaveKeyWithValue("team", "db"))
+		Expect(l).To(HaveKeyWithValue(LabelComponent, ComponentReplicaSet))
+		Expect(labels.SelectorFromSet(SelectorLabels(mongo, ComponentReplicaSet)).Matches(labels.Set(l))).To(BeTrue())
+		Expect(mongo.Labels).To(HaveKeyWithValue(LabelComponent, "custom"))
+	})
+})
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+)
+
+// Labels of the zone of a Node, the beta label is set by older Kubernetes versions
+const (
+	ZoneLabel     = "topology.kubernetes.io/zone"
+	ZoneLabelBeta = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// ValidateMemberConfig returns an error if a memberConfig entry does not select members by exactly one of ordinal
+// and zone, or gives priority to a member it makes non-voting
+func ValidateMemberConfig(specs []v1alpha1.MemberConfigSpec) error {
+	for i, spec := range specs {
+		if (spec.Ordinal == nil) == (spec.Zone == "") {
+			return fmt.Errorf("memberConfig[%d]: exactly one of ordinal and zone must be set", i)
+		}
+		if spec.Votes != nil && *spec.Votes == 0 && spec.Priority != nil && *spec.Priority > 0 {
+			return fmt.Errorf("memberConfig[%d]: members without votes must have priority 0", i)
+		}
+	}
+	return nil
+}
+
+// ApplyMemberConfig applies the memberConfig entries to the first data members of members, where members[i] runs
+// in the Pod with ordinal i and zones[i] is the zone of its node, "" if unknown.  An error is returned if an entry
+// selects an ordinal which is not a data member, or the resulting configuration is rejected by mongod or does not
+// have an odd number of voting members, also without entries.
+func ApplyMemberConfig(members []replicaset.MemberConfig, data int, specs []v1alpha1.MemberConfigSpec, zones []string) error {
+	if err := ValidateMemberConfig(specs); err != nil {
+		return err
+	}
+	for i, spec := range specs {
+		if spec.Ordinal != nil && int(*spec.Ordinal) >= data {
+			return fmt.Errorf("memberConfig[%d]: ordinal %d is not one of the %d data members", i, *spec.Ordinal, data)
+		}
+	}
+
+	for i := 0; i < data; i++ {
+		m := &members[i]
+		for _, spec := range specs {
+			if spec.Ordinal != nil && int(*spec.Ordinal) != i {
+				continue
+			}
+			if spec.Zone != "" && (i >= len(zones) || zones[i] != spec.Zone) {
+				continue
+			}
+			if spec.Votes != nil {
+				m.Votes = int(*spec.Votes)
+			}
+			if spec.Priority != nil {
+				m.Priority = float64(*spec.Priority)
+			}
+			if len(spec.Tags) > 0 {
+				m.Tags = map[string]string{}
+				for k, v := range spec.Tags {
+					m.Tags[k] = v
+				}
+			}
+		}
+		if m.Votes == 0 && m.Priority > 0 {
+			return fmt.Errorf("member %d has priority %g but no votes", i, m.Priority)
+		}
+	}
+
+	voting := 0
+	primaries := 0
+	for _, m := range members {
+		if m.Votes > 0 {
+			voting++
+		}
+		if m.Priority > 0 {
+			primaries++
+		}
+	}
+	if voting > replicaset.MaxVotingMembers {
+		return fmt.Errorf("the replica set would have %d voting members, at most %d are supported", voting, replicaset.MaxVotingMembers)
+	}
+	if voting%2 == 0 {
+		return fmt.Errorf("the replica set would have %d voting members, the number of voting members must be odd", voting)
+	}
+	if len(members) > 0 && primaries == 0 {
+		return fmt.Errorf("the replica set would have no member with priority that may become primary")
+	}
+	return nil
+}
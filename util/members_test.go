@@ -0,0 +1,85 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/replicaset"
+)
+
+var _ = Describe("ApplyMemberConfig", func() {
+	var members []replicaset.MemberConfig
+	zones := []string{"us-east1-a", "us-east1-b", "us-east1-c"}
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	BeforeEach(func() {
+		members = []replicaset.MemberConfig{
+			{Host: "foo-0", Votes: 1, Priority: 1},
+			{Host: "foo-1", Votes: 1, Priority: 1},
+			{Host: "foo-2", Votes: 1, Priority: 1},
+		}
+	})
+
+	It("should configure members by ordinal and zone", func() {
+		specs := []v1alpha1.MemberConfigSpec{
+			{Zone: "us-east1-b", Priority: int32Ptr(10), Tags: map[string]string{"dc": "east"}},
+			{Ordinal: int32Ptr(2), Priority: int32Ptr(0)},
+		}
+		Expect(ApplyMemberConfig(members, 3, specs, zones)).To(Succeed())
+		Expect(members[0].Priority).To(Equal(1.0))
+		Expect(members[1].Priority).To(Equal(10.0))
+		Expect(members[1].Tags).To(Equal(map[string]string{"dc": "east"}))
+		Expect(members[2].Priority).To(Equal(0.0))
+		Expect(members[2].Votes).To(Equal(1))
+	})
+
+	It("should reject an even number of voting members", func() {
+		specs := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(2), Votes: int32Ptr(0), Priority: int32Ptr(0)}}
+		Expect(ApplyMemberConfig(members, 3, specs, zones)).NotTo(Succeed())
+
+		members = append(members, replicaset.MemberConfig{Host: "foo-arbiter-0", ArbiterOnly: true, Votes: 1})
+		Expect(ApplyMemberConfig(members, 3, specs, zones)).To(Succeed())
+	})
+
+	It("should reject an even number of voting members without entries setting votes", func() {
+		members = members[:2]
+		specs := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(1), Tags: map[string]string{"dc": "east"}}}
+		Expect(ApplyMemberConfig(members, 2, specs, zones)).NotTo(Succeed())
+	})
+
+	It("should reject ordinals which are not data members", func() {
+		specs := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(3), Priority: int32Ptr(10)}}
+		Expect(ApplyMemberConfig(members, 3, specs, zones)).NotTo(Succeed())
+
+		specs = []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(2), Priority: int32Ptr(10)}}
+		Expect(ApplyMemberConfig(members, 2, specs, zones)).NotTo(Succeed())
+		Expect(ApplyMemberConfig(members, 3, specs, zones)).To(Succeed())
+	})
+
+	It("should reject priority without votes", func() {
+		specs := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(1), Votes: int32Ptr(0)}}
+		Expect(ApplyMemberConfig(members, 3, specs, zones)).NotTo(Succeed())
+	})
+
+	It("should reject entries selecting by both ordinal and zone", func() {
+		specs := []v1alpha1.MemberConfigSpec{{Ordinal: int32Ptr(1), Zone: "us-east1-a"}}
+		Expect(ValidateMemberConfig(specs)).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// DefaultExporterPort is the port the exporter serves metrics on if none is specified
+	DefaultExporterPort = int32(9216)
+
+	// MetricsPortName is the name of the exporter port on the Pods and Service
+	MetricsPortName = "metrics"
+)
+
+// ServiceMonitorGVK is the GroupVersionKind of the Prometheus Operator ServiceMonitor
+var ServiceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// MonitoringEnabled returns true if the exporter sidecar should be injected
+func MonitoringEnabled(monitoring *v1alpha1.MonitoringSpec) bool {
+	return monitoring != nil && monitoring.Enabled
+}
+
+// ServiceMonitorEnabled returns true if a ServiceMonitor should be generated
+func ServiceMonitorEnabled(monitoring *v1alpha1.MonitoringSpec) bool {
+	return MonitoringEnabled(monitoring) && monitoring.ServiceMonitor != nil && monitoring.ServiceMonitor.Enabled
+}
+
+func exporterPort(monitoring *v1alpha1.MonitoringSpec) int32 {
+	if monitoring.Port != nil {
+		return *monitoring.Port
+	}
+	return DefaultExporterPort
+}
+
+// SetMonitoringFields injects the exporter sidecar into the StatefulSet Pod template.  The exporter image
+// from the operator configuration is used if the spec does not set one.
+func SetMonitoringFields(ss *appsv1.StatefulSet, monitoring *v1alpha1.MonitoringSpec, defaults *operatorconfig.Config) {
+	if !MonitoringEnabled(monitoring) {
+		return
+	}
+	image := monitoring.Image
+	if image == "" {
+		image = defaults.Image(defaults.Images.Exporter)
+	}
+	port := exporterPort(monitoring)
+
+	ss.Spec.Template.Spec.Containers = append(ss.Spec.Template.Spec.Containers, corev1.Container{
+		Name:  "mongodb-exporter",
+		Image: image,
+		Args: []string{
+			"--mongodb.uri=mongodb://localhost:27017",
+			fmt.Sprintf("--web.listen-address=:%d", port),
+		},
+		Ports:     []corev1.ContainerPort{{Name: MetricsPortName, ContainerPort: port}},
+		Resources: monitoring.Resources,
+	})
+}
+
+// SetServiceMonitoringFields exposes the exporter metrics port on the Service
+func SetServiceMonitoringFields(service *corev1.Service, monitoring *v1alpha1.MonitoringSpec) {
+	if !MonitoringEnabled(monitoring) {
+		return
+	}
+	port := exporterPort(monitoring)
+	service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+		Name:       MetricsPortName,
+		Port:       port,
+		TargetPort: intstr.FromInt(int(port)),
+	})
+}
+
+// SetServiceMonitorFields sets fields on the ServiceMonitor scraping the exporter through the Service
+func SetServiceMonitorFields(sm *unstructured.Unstructured, service *corev1.Service, mongo metav1.Object, monitoring *v1alpha1.MonitoringSpec) error {
+	labels := Labels(mongo, ComponentReplicaSet)
+	for k, v := range monitoring.ServiceMonitor.Labels {
+		labels[k] = v
+	}
+	sm.SetLabels(labels)
+
+	endpoint := map[string]interface{}{"port": MetricsPortName}
+	if monitoring.ServiceMonitor.Interval != "" {
+		endpoint["interval"] = monitoring.ServiceMonitor.Interval
+	}
+	matchLabels := map[string]interface{}{}
+	for k, v := range service.Labels {
+		matchLabels[k] = v
+	}
+	spec := map[string]interface{}{
+		"selector":          map[string]interface{}{"matchLabels": matchLabels},
+		"namespaceSelector": map[string]interface{}{"matchNames": []interface{}{service.Namespace}},
+		"endpoints":         []interface{}{endpoint},
+	}
+	return unstructured.SetNestedField(sm.Object, spec, "spec")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("Monitoring", func() {
+	var monitoring *v1alpha1.MonitoringSpec
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	BeforeEach(func() {
+		monitoring = &v1alpha1.MonitoringSpec{Enabled: true}
+	})
+
+	It("should only be enabled if requested", func() {
+		Expect(MonitoringEnabled(nil)).To(BeFalse())
+		Expect(MonitoringEnabled(&v1alpha1.MonitoringSpec{})).To(BeFalse())
+		Expect(MonitoringEnabled(monitoring)).To(BeTrue())
+
+		Expect(ServiceMonitorEnabled(monitoring)).To(BeFalse())
+		monitoring.ServiceMonitor = &v1alpha1.ServiceMonitorSpec{Enabled: true}
+		Expect(ServiceMonitorEnabled(monitoring)).To(BeTrue())
+		monitoring.Enabled = false
+		Expect(ServiceMonitorEnabled(monitoring)).To(BeFalse())
+	})
+
+	Context("SetMonitoringFields", func() {
+		var ss *appsv1.StatefulSet
+
+		BeforeEach(func() {
+			ss = &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "mongo"}}},
+			}}}
+		})
+
+		It("should not inject the exporter unless enabled", func() {
+			SetMonitoringFields(ss, &v1alpha1.MonitoringSpec{}, operatorconfig.Default())
+			Expect(ss.Spec.Template.Spec.Containers).To(HaveLen(1))
+		})
+
+		It("should inject the exporter with the default image and port", func() {
+			SetMonitoringFields(ss, monitoring, operatorconfig.Default())
+
+			Expect(ss.Spec.Template.Spec.Containers).To(HaveLen(2))
+			exporter := ss.Spec.Template.Spec.Containers[1]
+			Expect(exporter.Name).To(Equal("mongodb-exporter"))
+			Expect(exporter.Image).To(Equal("percona/mongodb_exporter:0.11.0"))
+			Expect(exporter.Args).To(ContainElement("--web.listen-address=:9216"))
+			Expect(exporter.Ports).To(Equal([]corev1.ContainerPort{{Name: MetricsPortName, ContainerPort: DefaultExporterPort}}))
+		})
+
+		It("should inject the exporter with the image, port and resources of the spec", func() {
+			monitoring.Image = "registry.example.com/exporter:1.0"
+			monitoring.Port = int32Ptr(9100)
+			monitoring.Resources = corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+			}
+			SetMonitoringFields(ss, monitoring, operatorconfig.Default())
+
+			exporter := ss.Spec.Template.Spec.Containers[1]
+			Expect(exporter.Image).To(Equal("registry.example.com/exporter:1.0"))
+			Expect(exporter.Args).To(ContainElement("--web.listen-address=:9100"))
+			Expect(exporter.Ports[0].ContainerPort).To(Equal(int32(9100)))
+			Expect(exporter.Resources).To(Equal(monitoring.Resources))
+		})
+	})
+
+	It("should expose the exporter port on the Service", func() {
+		service := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "mongodb", Port: 27017}}}}
+		SetServiceMonitoringFields(service, &v1alpha1.MonitoringSpec{})
+		Expect(service.Spec.Ports).To(HaveLen(1))
+
+		monitoring.Port = int32Ptr(9100)
+		SetServiceMonitoringFields(service, monitoring)
+		Expect(service.Spec.Ports).To(HaveLen(2))
+		Expect(service.Spec.Ports[1]).To(Equal(corev1.ServicePort{
+			Name:       MetricsPortName,
+			Port:       9100,
+			TargetPort: intstr.FromInt(9100),
+		}))
+	})
+
+	It("should scrape the metrics port of the Service", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo-mongodb-service",
+			Namespace: "default",
+			Labels:    Labels(mongo, ComponentReplicaSet),
+		}}
+		monitoring.ServiceMonitor = &v1alpha1.ServiceMonitorSpec{
+			Enabled:  true,
+			Interval: "30s",
+			Labels:   map[string]string{"prometheus": "main"},
+		}
+		sm := &unstructured.Unstructured{}
+		sm.SetGroupVersionKind(ServiceMonitorGVK)
+		Expect(SetServiceMonitorFields(sm, service, mongo, monitoring)).To(Succeed())
+
+		Expect(sm.GetLabels()).To(HaveKeyWithValue("prometheus", "main"))
+		Expect(sm.GetLabels()).To(HaveKeyWithValue(LabelComponent, ComponentReplicaSet))
+
+		matchLabels := map[string]interface{}{}
+		for k, v := range service.Labels {
+			matchLabels[k] = v
+		}
+		Expect(sm.Object["spec"]).To(Equal(map[string]interface{}{
+			"selector":          map[string]interface{}{"matchLabels": matchLabels},
+			"namespaceSelector": map[string]interface{}{"matchNames": []interface{}{"default"}},
+			"endpoints":         []interface{}{map[string]interface{}{"port": MetricsPortName, "interval": "30s"}},
+		}))
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// SetNetworkPolicyFields sets fields on the NetworkPolicy of the members of the MongoDB.  Connections to mongod
+// are only allowed from the Pods of the MongoDB, e.g. other members and backup Jobs, the peers of the operator
+// configuration and the declared clients.  The exporter port is open to all scrapers.  All other ingress to the
+// members is denied.
+func SetNetworkPolicyFields(np *networkingv1.NetworkPolicy, mongo *v1alpha1.MongoDB, defaults *operatorconfig.Config) {
+	np.Labels = Labels(mongo, ComponentReplicaSet)
+
+	np.Spec.PodSelector = componentSelector(mongo, ComponentReplicaSet, ComponentArbiter, ComponentHidden, ComponentDelayed)
+	np.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+
+	// The components of a MongoDB differ from the ones of other kinds, so that the Pods of e.g. a
+	// MongoDBShardedCluster with the same name are not admitted
+	tcp := corev1.ProtocolTCP
+	mongod := intstr.FromInt(27017)
+	members := componentSelector(mongo, ComponentReplicaSet, ComponentArbiter, ComponentHidden, ComponentDelayed, ComponentBackup)
+	from := []networkingv1.NetworkPolicyPeer{{PodSelector: &members}}
+	from = append(from, defaults.NetworkPolicyPeers...)
+	if mongo.Spec.NetworkPolicy != nil {
+		from = append(from, mongo.Spec.NetworkPolicy.Clients...)
+	}
+	np.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{{
+		Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &mongod}},
+		From:  from,
+	}}
+	if MonitoringEnabled(mongo.Spec.Monitoring) {
+		exporter := intstr.FromInt(int(exporterPort(mongo.Spec.Monitoring)))
+		np.Spec.Ingress = append(np.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &exporter}},
+		})
+	}
+}
+
+// BlocksExternalClients returns true if the MongoDB is exposed by externalAccess but its NetworkPolicy allows no
+// clients by an ipBlock, so that clients outside the cluster cannot connect
+func BlocksExternalClients(mongo *v1alpha1.MongoDB) bool {
+	if mongo.Spec.ExternalAccess == nil || mongo.Spec.NetworkPolicy == nil {
+		return false
+	}
+	for _, peer := range mongo.Spec.NetworkPolicy.Clients {
+		if peer.IPBlock != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// componentSelector returns the selector of the Pods of the given components of the instance
+func componentSelector(instance metav1.Object, components ...string) metav1.LabelSelector {
+	labels := SelectorLabels(instance, "")
+	delete(labels, LabelComponent)
+	return metav1.LabelSelector{
+		MatchLabels: labels,
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      LabelComponent,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   components,
+		}},
+	}
+}
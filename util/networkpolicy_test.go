@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("SetNetworkPolicyFields", func() {
+	var mongo *v1alpha1.MongoDB
+	clients := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			Spec: v1alpha1.MongoDBSpec{NetworkPolicy: &v1alpha1.NetworkPolicySpec{
+				Clients: []networkingv1.NetworkPolicyPeer{{PodSelector: clients}},
+			}},
+		}
+	})
+
+	It("should allow the members, the operator and the clients", func() {
+		np := &networkingv1.NetworkPolicy{}
+		defaults := operatorconfig.Default()
+		SetNetworkPolicyFields(np, mongo, defaults)
+
+		Expect(np.Spec.PodSelector.MatchLabels).To(HaveKeyWithValue(LabelInstance, "foo"))
+		Expect(np.Spec.PodSelector.MatchLabels).NotTo(HaveKey(LabelComponent))
+		Expect(np.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress))
+		Expect(np.Spec.Ingress).To(HaveLen(1))
+		Expect(*np.Spec.Ingress[0].Ports[0].Port).To(Equal(intstr.FromInt(27017)))
+		Expect(np.Spec.Ingress[0].From).To(HaveLen(3))
+		Expect(np.Spec.Ingress[0].From[0].PodSelector.MatchLabels).To(HaveKeyWithValue(LabelInstance, "foo"))
+		Expect(np.Spec.Ingress[0].From[1]).To(Equal(defaults.NetworkPolicyPeers[0]))
+		Expect(np.Spec.Ingress[0].From[2].PodSelector).To(Equal(clients))
+	})
+
+	It("should open the exporter port", func() {
+		mongo.Spec.Monitoring = &v1alpha1.MonitoringSpec{Enabled: true}
+		np := &networkingv1.NetworkPolicy{}
+		SetNetworkPolicyFields(np, mongo, operatorconfig.Default())
+
+		Expect(np.Spec.Ingress).To(HaveLen(2))
+		Expect(*np.Spec.Ingress[1].Ports[0].Port).To(Equal(intstr.FromInt(int(DefaultExporterPort))))
+		Expect(np.Spec.Ingress[1].From).To(BeEmpty())
+	})
+
+	It("should not admit the Pods of other kinds with the same name", func() {
+		np := &networkingv1.NetworkPolicy{}
+		SetNetworkPolicyFields(np, mongo, operatorconfig.Default())
+
+		members, err := metav1.LabelSelectorAsSelector(np.Spec.Ingress[0].From[0].PodSelector)
+		Expect(err).NotTo(HaveOccurred())
+		cluster := &v1alpha1.MongoDBShardedCluster{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		Expect(members.Matches(labels.Set(SelectorLabels(mongo, ComponentArbiter)))).To(BeTrue())
+		Expect(members.Matches(labels.Set(SelectorLabels(mongo, ComponentBackup)))).To(BeTrue())
+		Expect(members.Matches(labels.Set(SelectorLabels(cluster, ComponentMongos)))).To(BeFalse())
+		Expect(members.Matches(labels.Set(SelectorLabels(cluster, ShardComponent(0))))).To(BeFalse())
+	})
+})
+
+var _ = Describe("BlocksExternalClients", func() {
+	It("should require an ipBlock if the members are exposed", func() {
+		mongo := &v1alpha1.MongoDB{Spec: v1alpha1.MongoDBSpec{NetworkPolicy: &v1alpha1.NetworkPolicySpec{}}}
+		Expect(BlocksExternalClients(mongo)).To(BeFalse())
+
+		mongo.Spec.ExternalAccess = &v1alpha1.ExternalAccessSpec{Type: corev1.ServiceTypeLoadBalancer}
+		Expect(BlocksExternalClients(mongo)).To(BeTrue())
+
+		mongo.Spec.NetworkPolicy.Clients = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/8"}}}
+		Expect(BlocksExternalClients(mongo)).To(BeFalse())
+	})
+})
@@ -0,0 +1,202 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// MergeStatefulSetOverrides strategically merges the podTemplate and statefulSetOverrides from the MongoDB
+// spec on top of the generated StatefulSet, and validates the result.
+func MergeStatefulSetOverrides(ss *appsv1.StatefulSet, podTemplate *corev1.PodTemplateSpec, overrides *v1alpha1.StatefulSetOverrides) error {
+	if podTemplate == nil && overrides == nil {
+		return nil
+	}
+
+	patch := map[string]interface{}{}
+	if overrides != nil {
+		o, err := toPatchMap(overrides)
+		if err != nil {
+			return err
+		}
+		meta := map[string]interface{}{}
+		if v, ok := o["labels"]; ok {
+			meta["labels"] = v
+		}
+		if v, ok := o["annotations"]; ok {
+			meta["annotations"] = v
+		}
+		if len(meta) > 0 {
+			patch["metadata"] = meta
+		}
+		if v, ok := o["spec"]; ok {
+			patch["spec"] = v
+		}
+	}
+	if podTemplate != nil {
+		t, err := toPatchMap(podTemplate)
+		if err != nil {
+			return err
+		}
+		spec, ok := patch["spec"].(map[string]interface{})
+		if !ok {
+			spec = map[string]interface{}{}
+			patch["spec"] = spec
+		}
+		spec["template"] = t
+	}
+
+	original, err := json.Marshal(ss)
+	if err != nil {
+		return err
+	}
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	mergedJSON, err := strategicpatch.StrategicMergePatch(original, patchJSON, appsv1.StatefulSet{})
+	if err != nil {
+		return fmt.Errorf("unable to merge overrides into StatefulSet: %v", err)
+	}
+	merged := appsv1.StatefulSet{}
+	if err := json.Unmarshal(mergedJSON, &merged); err != nil {
+		return err
+	}
+	if err := ValidateStatefulSet(&merged); err != nil {
+		return fmt.Errorf("invalid StatefulSet after merging overrides: %v", err)
+	}
+	*ss = merged
+	return nil
+}
+
+// ValidateStatefulSet performs basic validation of a generated StatefulSet so that invalid overrides
+// are reported rather than sent to the apiserver.
+func ValidateStatefulSet(ss *appsv1.StatefulSet) error {
+	if ss.Spec.Selector == nil {
+		return fmt.Errorf("spec.selector must be set")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(ss.Spec.Selector)
+	if err != nil {
+		return fmt.Errorf("spec.selector: %v", err)
+	}
+	if !selector.Matches(labels.Set(ss.Spec.Template.Labels)) {
+		return fmt.Errorf("spec.template.metadata.labels must match spec.selector")
+	}
+
+	pod := ss.Spec.Template.Spec
+	if len(pod.Containers) == 0 {
+		return fmt.Errorf("spec.template.spec.containers must not be empty")
+	}
+
+	volumes := map[string]bool{}
+	for _, v := range pod.Volumes {
+		if volumes[v.Name] {
+			return fmt.Errorf("spec.template.spec.volumes: duplicate volume %q", v.Name)
+		}
+		volumes[v.Name] = true
+	}
+	for _, pvc := range ss.Spec.VolumeClaimTemplates {
+		volumes[pvc.Name] = true
+	}
+
+	names := map[string]bool{}
+	containers := append(append([]corev1.Container{}, pod.InitContainers...), pod.Containers...)
+	for _, c := range containers {
+		if c.Name == "" {
+			return fmt.Errorf("spec.template.spec.containers: name must be set")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("spec.template.spec.containers: duplicate container %q", c.Name)
+		}
+		names[c.Name] = true
+		if c.Image == "" {
+			return fmt.Errorf("spec.template.spec.containers[%s]: image must be set", c.Name)
+		}
+		for _, m := range c.VolumeMounts {
+			if !volumes[m.Name] {
+				return fmt.Errorf("spec.template.spec.containers[%s]: volume mount %q has no matching volume", c.Name, m.Name)
+			}
+		}
+		for _, p := range c.Ports {
+			if p.ContainerPort <= 0 || p.ContainerPort > 65535 {
+				return fmt.Errorf("spec.template.spec.containers[%s]: invalid container port %d", c.Name, p.ContainerPort)
+			}
+		}
+	}
+	if !names["mongo"] {
+		return fmt.Errorf("spec.template.spec.containers: the mongo container must not be removed")
+	}
+	return nil
+}
+
+// ImmutableFieldChanges returns the paths of the fields of the StatefulSet spec which cannot be changed once it is
+// created, e.g. the volume claim templates, and are set by the generated StatefulSet to a different value than on
+// the live one
+func ImmutableFieldChanges(generated, live *appsv1.StatefulSet) ([]string, error) {
+	return Drift(immutableFields(generated), immutableFields(live))
+}
+
+// immutableFields returns a StatefulSet with only the fields of the spec of ss which cannot be updated
+func immutableFields(ss *appsv1.StatefulSet) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{
+		Selector:             ss.Spec.Selector,
+		ServiceName:          ss.Spec.ServiceName,
+		PodManagementPolicy:  ss.Spec.PodManagementPolicy,
+		RevisionHistoryLimit: ss.Spec.RevisionHistoryLimit,
+		VolumeClaimTemplates: ss.Spec.VolumeClaimTemplates,
+	}}
+}
+
+// toPatchMap converts obj into a map suitable for use as a strategic merge patch. Null values are dropped
+// so that unset fields in obj do not delete the generated values.
+func toPatchMap(obj interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	removeNulls(m)
+	return m, nil
+}
+
+func removeNulls(m map[string]interface{}) {
+	for k, v := range m {
+		switch val := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]interface{}:
+			removeNulls(val)
+		case []interface{}:
+			for _, item := range val {
+				if im, ok := item.(map[string]interface{}); ok {
+					removeNulls(im)
+				}
+			}
+		}
+	}
+}
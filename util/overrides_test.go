@@ -0,0 +1,237 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("MergeStatefulSetOverrides", func() {
+	var (
+		mongo   *v1alpha1.MongoDB
+		service *corev1.Service
+		ss      *appsv1.StatefulSet
+	)
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		ss = &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, nil, operatorconfig.Default())
+	})
+
+	It("should merge containers by name and keep generated fields", func() {
+		podTemplate := &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"vault.hashicorp.com/agent-inject": "true"}},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: "mongo",
+				Containers: []corev1.Container{
+					{Name: "mongo", Env: []corev1.EnvVar{{Name: "FOO", Value: "bar"}}},
+					{Name: "extra", Image: "busybox"},
+				},
+			},
+		}
+		overrides := &v1alpha1.StatefulSetOverrides{Labels: map[string]string{"team": "platform"}}
+
+		Expect(MergeStatefulSetOverrides(ss, podTemplate, overrides)).To(Succeed())
+		Expect(ss.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(ss.Spec.Template.Annotations).To(HaveKeyWithValue("vault.hashicorp.com/agent-inject", "true"))
+		Expect(ss.Spec.Template.Spec.ServiceAccountName).To(Equal("mongo"))
+		Expect(ss.Spec.Template.Spec.Containers).To(HaveLen(2))
+		Expect(ss.Spec.Template.Spec.Containers[0].Image).To(Equal("mongo"))
+		Expect(ss.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "FOO", Value: "bar"}))
+		Expect(ss.Spec.Template.Labels).To(Equal(ss.Spec.Selector.MatchLabels))
+	})
+
+	It("should reject overrides that break the selector", func() {
+		podTemplate := &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{LabelInstance: "bar"}},
+		}
+		Expect(MergeStatefulSetOverrides(ss, podTemplate, nil)).NotTo(Succeed())
+	})
+
+	It("should reject volume mounts without a volume", func() {
+		podTemplate := &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "mongo", VolumeMounts: []corev1.VolumeMount{{Name: "missing", MountPath: "/missing"}}},
+				},
+			},
+		}
+		Expect(MergeStatefulSetOverrides(ss, podTemplate, nil)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("SetStatefulSetFields", func() {
+	It("should apply the operator configuration", func() {
+		defaults := operatorconfig.Default()
+		defaults.ImageRegistry = "registry.example.com"
+		defaults.StorageClassName = "fast"
+		defaults.Labels = map[string]string{"team": "platform", LabelInstance: "bar"}
+
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		ss := &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, nil, defaults)
+
+		Expect(ContainerImage(&ss.Spec.Template, "mongo")).To(Equal("registry.example.com/mongo"))
+		Expect(*ss.Spec.VolumeClaimTemplates[0].Spec.StorageClassName).To(Equal("fast"))
+		Expect(ss.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(ss.Spec.Template.Labels).NotTo(HaveKey("team"))
+		Expect(ss.Spec.Template.Labels).To(HaveKeyWithValue(LabelInstance, "foo"))
+		Expect(ss.Spec.Selector.MatchLabels).NotTo(HaveKey("team"))
+		Expect(ValidateStatefulSet(ss)).To(Succeed())
+	})
+
+	It("should only report members ready in the primary, secondary or arbiter state", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		ss := &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, &corev1.Service{}, &corev1.ConfigMap{}, mongo, nil, nil, operatorconfig.Default())
+
+		probe := ss.Spec.Template.Spec.Containers[0].ReadinessProbe
+		Expect(probe.TCPSocket).To(BeNil())
+		Expect(probe.Exec).NotTo(BeNil())
+		Expect(probe.Exec.Command).To(Equal([]string{"sh", "-c", memberReadyScript}))
+		Expect(memberReadyScript).To(ContainSubstring("m.secondary"))
+	})
+
+	It("should keep the default images of existing StatefulSets", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		defaults := operatorconfig.Default()
+		defaults.Images.Mongo.Tag = "4.0"
+		created := &appsv1.StatefulSet{}
+		SetStatefulSetFields(created, service, configMap, mongo, nil, nil, defaults)
+		PinDefaultImages(created, &created.Spec.Template, nil)
+		Expect(created.Annotations).To(HaveKeyWithValue(DefaultImageAnnotationPrefix+"mongo", "mongo:4.0"))
+
+		defaults.Images.Mongo.Tag = "4.2"
+		ss := &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, nil, defaults)
+		PinDefaultImages(ss, &ss.Spec.Template, created.Annotations)
+		Expect(ContainerImage(&ss.Spec.Template, "mongo")).To(Equal("mongo:4.0"))
+		Expect(ss.Annotations).To(HaveKeyWithValue(DefaultImageAnnotationPrefix+"mongo", "mongo:4.0"))
+
+		// The Pod template of the spec still takes precedence
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "mongo", Image: "mongo:4.2"}},
+		}}
+		Expect(MergeStatefulSetOverrides(ss, podTemplate, nil)).To(Succeed())
+		Expect(ContainerImage(&ss.Spec.Template, "mongo")).To(Equal("mongo:4.2"))
+	})
+
+	It("should select the Pods by the standard labels", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", Labels: map[string]string{"team": "platform"}}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		ss := &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, nil, operatorconfig.Default())
+		SetServiceFields(service, mongo)
+
+		Expect(ss.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(ss.Labels).To(HaveKeyWithValue(LabelManagedBy, ManagedBy))
+		Expect(ss.Spec.Selector.MatchLabels).To(Equal(map[string]string{
+			LabelName:      AppName,
+			LabelInstance:  "foo",
+			LabelManagedBy: ManagedBy,
+			LabelComponent: ComponentReplicaSet,
+		}))
+		Expect(service.Spec.Selector).To(Equal(ss.Spec.Selector.MatchLabels))
+	})
+})
+
+var _ = Describe("SetMemberStatefulSetFields", func() {
+	It("should store the data of arbiters in an emptyDir", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: MemberSetName(mongo, ComponentArbiter)}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		replicas := int32(1)
+		ss := &appsv1.StatefulSet{}
+		SetMemberStatefulSetFields(ss, service, configMap, mongo, ComponentArbiter, &replicas, nil, operatorconfig.Default())
+
+		Expect(ss.Spec.VolumeClaimTemplates).To(BeEmpty())
+		Expect(ss.Spec.Selector.MatchLabels).To(HaveKeyWithValue(LabelComponent, ComponentArbiter))
+		Expect(ss.Spec.ServiceName).To(Equal("foo-mongodb-arbiter"))
+		Expect(ValidateStatefulSet(ss)).To(Succeed())
+	})
+
+	It("should store ephemeral data in an emptyDir", func() {
+		mongo := &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+		storage := v1alpha1.StorageEphemeral
+		ss := &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, &storage, operatorconfig.Default())
+
+		Expect(ss.Spec.VolumeClaimTemplates).To(BeEmpty())
+		Expect(ss.Spec.Template.Spec.Volumes).To(ContainElement(corev1.Volume{
+			Name:         "mongo-persistent-storage",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}))
+		Expect(ValidateStatefulSet(ss)).To(Succeed())
+	})
+})
+
+var _ = Describe("ImmutableFieldChanges", func() {
+	var mongo *v1alpha1.MongoDB
+	var service *corev1.Service
+	var configMap *corev1.ConfigMap
+
+	generate := func(storage string) *appsv1.StatefulSet {
+		ss := &appsv1.StatefulSet{}
+		SetStatefulSetFields(ss, service, configMap, mongo, nil, &storage, operatorconfig.Default())
+		return ss
+	}
+
+	BeforeEach(func() {
+		mongo = &v1alpha1.MongoDB{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		service = &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-service"}}
+		configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo-mongodb-config"}}
+	})
+
+	It("should ignore the fields defaulted on the live StatefulSet", func() {
+		live := generate("10Gi")
+		filesystem := corev1.PersistentVolumeFilesystem
+		live.Spec.VolumeClaimTemplates[0].Spec.VolumeMode = &filesystem
+		live.Spec.VolumeClaimTemplates[0].Status.Phase = corev1.ClaimPending
+		live.Spec.Template.Spec.Containers[0].Image = "mongo:4.2"
+
+		Expect(ImmutableFieldChanges(generate("10Gi"), live)).To(BeEmpty())
+	})
+
+	It("should report a changed storage size", func() {
+		paths, err := ImmutableFieldChanges(generate("20Gi"), generate("10Gi"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"spec.volumeClaimTemplates[0].spec.resources.requests.storage"}))
+	})
+
+	It("should report added volume claim templates", func() {
+		paths, err := ImmutableFieldChanges(generate("10Gi"), generate(v1alpha1.StorageEphemeral))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(paths).To(Equal([]string{"spec.volumeClaimTemplates"}))
+	})
+})
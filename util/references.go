@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The Kubernetes authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ReferencesHashAnnotation is set on the Pod template to the hash of the contents of the Secrets and
+// ConfigMaps referenced by the Pods so that changes to them trigger a rolling restart
+const ReferencesHashAnnotation = "databases.example.com/references-hash"
+
+// ReferencedObjects returns the sorted names of the Secrets and ConfigMaps referenced by the Pod template
+// through volumes, env and envFrom.  imagePullSecrets are not returned as they are only read to pull images,
+// so running Pods need not be restarted when they change.
+func ReferencedObjects(template *corev1.PodTemplateSpec) (secrets, configMaps []string) {
+	if template == nil {
+		return nil, nil
+	}
+	s := map[string]bool{}
+	c := map[string]bool{}
+
+	for _, v := range template.Spec.Volumes {
+		if v.Secret != nil {
+			s[v.Secret.SecretName] = true
+		}
+		if v.ConfigMap != nil {
+			c[v.ConfigMap.Name] = true
+		}
+		if v.Projected != nil {
+			for _, p := range v.Projected.Sources {
+				if p.Secret != nil {
+					s[p.Secret.Name] = true
+				}
+				if p.ConfigMap != nil {
+					c[p.ConfigMap.Name] = true
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, template.Spec.InitContainers...), template.Spec.Containers...)
+	for _, container := range containers {
+		for _, e := range container.EnvFrom {
+			if e.SecretRef != nil {
+				s[e.SecretRef.Name] = true
+			}
+			if e.ConfigMapRef != nil {
+				c[e.ConfigMapRef.Name] = true
+			}
+		}
+		for _, e := range container.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if e.ValueFrom.SecretKeyRef != nil {
+				s[e.ValueFrom.SecretKeyRef.Name] = true
+			}
+			if e.ValueFrom.ConfigMapKeyRef != nil {
+				c[e.ValueFrom.ConfigMapKeyRef.Name] = true
+			}
+		}
+	}
+
+	return sortedKeys(s), sortedKeys(c)
+}
+
+// ReferencesHash returns a hash of the contents of the referenced Secrets and ConfigMaps which does not depend
+// on their order or metadata
+func ReferencesHash(secrets []corev1.Secret, configMaps []corev1.ConfigMap) string {
+	data := map[string]string{}
+	for _, secret := range secrets {
+		for k, v := range secret.Data {
+			data["secret/"+secret.Name+"/"+k] = string(v)
+		}
+	}
+	for _, cm := range configMaps {
+		for k, v := range cm.Data {
+			data["configmap/"+cm.Name+"/"+k] = v
+		}
+		for k, v := range cm.BinaryData {
+			data["configmap/"+cm.Name+"/"+k] = string(v)
+		}
+	}
+	return ConfigHash(data)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ReferencedObjects", func() {
+	It("should return nothing without a Pod template", func() {
+		secrets, configMaps := ReferencedObjects(nil)
+		Expect(secrets).To(BeEmpty())
+		Expect(configMaps).To(BeEmpty())
+	})
+
+	table.DescribeTable("should return the Secrets and ConfigMaps referenced by the Pods",
+		func(spec corev1.PodSpec, wantSecrets, wantConfigMaps []string) {
+			secrets, configMaps := ReferencedObjects(&corev1.PodTemplateSpec{Spec: spec})
+			Expect(secrets).To(Equal(wantSecrets))
+			Expect(configMaps).To(Equal(wantConfigMaps))
+		},
+		table.Entry("env", corev1.PodSpec{
+			Containers: []corev1.Container{{Env: []corev1.EnvVar{
+				{Name: "PLAIN", Value: "foo"},
+				{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}},
+				}},
+				{Name: "LEVEL", ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}},
+				}},
+				{Name: "NODE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+			}}},
+		}, []string{"creds"}, []string{"settings"}),
+		table.Entry("envFrom of init containers and containers", corev1.PodSpec{
+			InitContainers: []corev1.Container{{EnvFrom: []corev1.EnvFromSource{
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "init-creds"}}},
+			}}},
+			Containers: []corev1.Container{{EnvFrom: []corev1.EnvFromSource{
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}}},
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}},
+			}}},
+		}, []string{"creds", "init-creds"}, []string{"settings"}),
+		table.Entry("volumes", corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+				{Name: "scripts", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "scripts"},
+				}}},
+				{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		}, []string{"tls"}, []string{"scripts"}),
+		table.Entry("projected volumes", corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: "all", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "keyfile"}}},
+					{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}}},
+					{DownwardAPI: &corev1.DownwardAPIProjection{}},
+				},
+			}}}},
+		}, []string{"keyfile"}, []string{"ca"}),
+		table.Entry("repeated references once, sorted", corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+			},
+			Containers: []corev1.Container{{EnvFrom: []corev1.EnvFromSource{
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tls"}}},
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "creds"}}},
+			}}},
+		}, []string{"creds", "tls"}, nil),
+		table.Entry("no imagePullSecrets", corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+		}, nil, nil),
+	)
+})
+
+var _ = Describe("ReferencesHash", func() {
+	var secrets []corev1.Secret
+	var configMaps []corev1.ConfigMap
+
+	BeforeEach(func() {
+		secrets = []corev1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: "creds"}, Data: map[string][]byte{"password": []byte("foo")}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "tls"}, Data: map[string][]byte{"tls.crt": []byte("bar")}},
+		}
+		configMaps = []corev1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Name: "settings"}, Data: map[string]string{"level": "1"}},
+		}
+	})
+
+	It("should not depend on the order or metadata of the objects", func() {
+		hash := ReferencesHash(secrets, configMaps)
+		Expect(hash).To(Equal(ReferencesHash(secrets, configMaps)))
+
+		secrets[0], secrets[1] = secrets[1], secrets[0]
+		secrets[0].ResourceVersion = "42"
+		configMaps[0].Labels = map[string]string{"foo": "bar"}
+		Expect(ReferencesHash(secrets, configMaps)).To(Equal(hash))
+	})
+
+	It("should change with the contents of the objects", func() {
+		hash := ReferencesHash(secrets, configMaps)
+
+		secrets[0].Data["password"] = []byte("baz")
+		Expect(ReferencesHash(secrets, configMaps)).NotTo(Equal(hash))
+	})
+
+	It("should tell apart keys of different objects", func() {
+		Expect(ReferencesHash(nil, []corev1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"level": "1"}},
+		})).NotTo(Equal(ReferencesHash(nil, []corev1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Data: map[string]string{"level": "1"}},
+		})))
+		Expect(ReferencesHash([]corev1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string][]byte{"level": []byte("1")}},
+		}, nil)).NotTo(Equal(ReferencesHash(nil, []corev1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Data: map[string]string{"level": "1"}},
+		})))
+	})
+})
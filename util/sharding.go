@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// SetMongosDeploymentFields sets fields on the Deployment running the mongos query routers of the sharded cluster
+// cluster: MongoDBShardedCluster instance
+// configDB: the connection string of the config server replica set
+// replicas: the number of mongos
+// defaults: the operator configuration used for unset fields
+func SetMongosDeploymentFields(deploy *appsv1.Deployment, cluster metav1.Object, configDB string, replicas *int32, defaults *operatorconfig.Config) {
+	gracePeriodTerm := defaults.TerminationGracePeriodSeconds
+
+	deploy.Labels = Labels(cluster, ComponentMongos)
+	deploy.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: SelectorLabels(cluster, ComponentMongos),
+	}
+	deploy.Spec.Replicas = replicas
+	deploy.Spec.Template = corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: SelectorLabels(cluster, ComponentMongos),
+		},
+		Spec: corev1.PodSpec{
+			TerminationGracePeriodSeconds: &gracePeriodTerm,
+			Containers: []corev1.Container{
+				{
+					Name:    "mongos",
+					Image:   defaults.Image(defaults.Images.Mongo),
+					Command: []string{"mongos", "--configdb", configDB, "--bind_ip_all", "--port", "27017"},
+					Ports:   []corev1.ContainerPort{{ContainerPort: 27017}},
+					ReadinessProbe: &corev1.Probe{
+						Handler: corev1.Handler{
+							TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(27017)},
+						},
+						InitialDelaySeconds: 5,
+						PeriodSeconds:       10,
+					},
+					Resources: *defaults.Resources.DeepCopy(),
+				},
+			},
+		},
+	}
+
+	SetDefaultMetadata(deploy, defaults)
+}
+
+// SetMongosServiceFields sets fields on the Service clients of the sharded cluster connect to
+func SetMongosServiceFields(service *corev1.Service, cluster metav1.Object) {
+	service.Labels = Labels(cluster, ComponentMongos)
+
+	service.Spec.Ports = []corev1.ServicePort{
+		{Name: "mongodb", Port: 27017, TargetPort: intstr.IntOrString{IntVal: 27017, Type: intstr.Int}},
+	}
+	service.Spec.Selector = SelectorLabels(cluster, ComponentMongos)
+}
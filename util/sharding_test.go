@@ -0,0 +1,42 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SetMongosDeploymentFields", func() {
+	It("should route through the config servers", func() {
+		cluster := &v1alpha1.MongoDBShardedCluster{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		replicas := int32(2)
+		deploy := &appsv1.Deployment{}
+		SetMongosDeploymentFields(deploy, cluster, "configsvr/foo-mongodb-configsvr-0.foo-mongodb-configsvr.default.svc:27017", &replicas, operatorconfig.Default())
+
+		Expect(*deploy.Spec.Replicas).To(Equal(int32(2)))
+		Expect(deploy.Spec.Selector.MatchLabels).To(HaveKeyWithValue(LabelComponent, ComponentMongos))
+		Expect(deploy.Spec.Template.Labels).To(Equal(deploy.Spec.Selector.MatchLabels))
+		Expect(deploy.Spec.Template.Spec.Containers[0].Command).
+			To(ContainElement("configsvr/foo-mongodb-configsvr-0.foo-mongodb-configsvr.default.svc:27017"))
+	})
+})
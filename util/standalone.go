@@ -0,0 +1,40 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+)
+
+// ValidateStandalone returns an error if a standalone MongoDB configures more than one member or replica set
+// members
+func ValidateStandalone(spec *v1alpha1.MongoDBSpec) error {
+	if !spec.IsStandalone() {
+		return nil
+	}
+	switch {
+	case spec.Replicas != nil && *spec.Replicas != 1:
+		return fmt.Errorf("a Standalone MongoDB runs a single member, replicas must be 1")
+	case spec.Arbiters != nil || spec.HiddenMembers != nil || spec.DelayedMembers != nil:
+		return fmt.Errorf("a Standalone MongoDB does not support arbiters, hidden or delayed members")
+	case len(spec.MemberConfig) > 0:
+		return fmt.Errorf("a Standalone MongoDB does not support memberConfig")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+)
+
+var _ = Describe("ValidateStandalone", func() {
+	It("should accept a single member", func() {
+		replicas := int32(1)
+		Expect(ValidateStandalone(&v1alpha1.MongoDBSpec{Type: v1alpha1.TypeStandalone, Replicas: &replicas})).To(Succeed())
+		Expect(ValidateStandalone(&v1alpha1.MongoDBSpec{Type: v1alpha1.TypeStandalone})).To(Succeed())
+	})
+
+	It("should reject replica set members", func() {
+		replicas := int32(3)
+		Expect(ValidateStandalone(&v1alpha1.MongoDBSpec{Type: v1alpha1.TypeStandalone, Replicas: &replicas})).NotTo(Succeed())
+		Expect(ValidateStandalone(&v1alpha1.MongoDBSpec{
+			Type:     v1alpha1.TypeStandalone,
+			Arbiters: &v1alpha1.ArbitersSpec{Replicas: 1},
+		})).NotTo(Succeed())
+		Expect(ValidateStandalone(&v1alpha1.MongoDBSpec{Replicas: &replicas})).To(Succeed())
+	})
+})
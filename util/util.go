@@ -17,6 +17,8 @@ limitations under the License.
 package util
 
 import (
+	"github.com/pwittrock/kubebuilder-workshop/api/v1alpha1"
+	"github.com/pwittrock/kubebuilder-workshop/operatorconfig"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -24,68 +26,106 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// memberReadyScript exits successfully once the local mongod is the primary, a secondary or an arbiter, so that
+// a restarted member is only ready after it recovered and reached the SECONDARY state.  Standalone instances
+// are always primary, and members are also ready before they are added to the replica set, so that the replica set
+// can be initiated and the members added.  Images without the legacy mongo shell have mongosh.
+const memberReadyScript = `shell=mongo; command -v mongo >/dev/null || shell=mongosh
+exec $shell --quiet --eval 'var m = db.isMaster(); if (!(m.ismaster || m.secondary || m.arbiterOnly || m.isreplicaset)) { quit(1) }'`
+
+// DefaultImageAnnotationPrefix is followed by the container name in the annotations recording the default images
+// of the containers of a StatefulSet or Deployment
+const DefaultImageAnnotationPrefix = "databases.example.com/default-image-"
+
 // SetStatefulSetFields sets fields on a appsv1.StatefulSet pointer generated for the MongoDB instance
 // object: MongoDB instance
+// configMap: the ConfigMap containing the mongod configuration
 // replicas: the number of replicas for the MongoDB instance
 // storage: the size of the storage for the MongoDB instance (e.g. 100Gi)
-func SetStatefulSetFields(ss *appsv1.StatefulSet, service *corev1.Service, mongo metav1.Object, replicas *int32, storage *string) {
-	gracePeriodTerm := int64(10)
+// defaults: the operator configuration used for unset fields
+func SetStatefulSetFields(ss *appsv1.StatefulSet, service *corev1.Service, configMap *corev1.ConfigMap, mongo metav1.Object, replicas *int32, storage *string, defaults *operatorconfig.Config) {
+	SetMemberStatefulSetFields(ss, service, configMap, mongo, ComponentReplicaSet, replicas, storage, defaults)
+}
+
+// MemberSetName returns the name of the StatefulSet and of its governing Service running the arbiters, hidden
+// or delayed members of the MongoDB instance
+func MemberSetName(mongo metav1.Object, component string) string {
+	return mongo.GetName() + "-mongodb-" + component
+}
+
+// SetMemberStatefulSetFields sets fields on the StatefulSet running the members of the component of the MongoDB
+// instance.  The data directory is an emptyDir instead of a PersistentVolumeClaim if storage is ephemeral, and
+// for arbiters which hold no data.
+func SetMemberStatefulSetFields(ss *appsv1.StatefulSet, service *corev1.Service, configMap *corev1.ConfigMap, mongo metav1.Object, component string, replicas *int32, storage *string, defaults *operatorconfig.Config) {
+	gracePeriodTerm := defaults.TerminationGracePeriodSeconds
 
 	if replicas == nil {
-		r := int32(1)
+		r := defaults.Replicas
 		replicas = &r
 	}
 	if storage == nil {
-		s := "100Gi"
+		s := defaults.Storage
 		storage = &s
 	}
 
-	copyLabels := mongo.GetLabels()
-	if copyLabels == nil {
-		copyLabels = map[string]string{}
-	}
-
-	labels := map[string]string{}
-	for k, v := range copyLabels {
-		labels[k] = v
-	}
-	labels["mongodb-statefuleset"] = mongo.GetName()
-
+	ephemeral := component == ComponentArbiter || *storage == v1alpha1.StorageEphemeral
 	rl := corev1.ResourceList{}
-	rl["storage"] = resource.MustParse(*storage)
+	if !ephemeral {
+		rl["storage"] = resource.MustParse(*storage)
+	}
 
-	ss.Labels = labels
+	ss.Labels = Labels(mongo, component)
 	ss.Spec.Selector = &metav1.LabelSelector{
-		MatchLabels: map[string]string{"mongodb-statefulset": mongo.GetName()},
+		MatchLabels: SelectorLabels(mongo, component),
 	}
 	ss.Spec.ServiceName = service.Name
 	ss.Spec.Replicas = replicas
+	ss.Spec.UpdateStrategy = appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}
 	ss.Spec.Template = corev1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
-			Labels: ss.Spec.Selector.MatchLabels,
+			Labels:      SelectorLabels(mongo, component),
+			Annotations: map[string]string{ConfigHashAnnotation: ConfigHash(configMap.Data)},
 		},
 
 		Spec: corev1.PodSpec{
 			TerminationGracePeriodSeconds: &gracePeriodTerm,
 			Containers: []corev1.Container{
 				{
-					Name:         "mongo",
-					Image:        "mongo",
-					Command:      []string{"mongod", "--replSet", "rs0", "--smallfiles", "--noprealloc", "--bind_ip_all"},
-					Ports:        []corev1.ContainerPort{{ContainerPort: 27017}},
-					VolumeMounts: []corev1.VolumeMount{{Name: "mongo-persistent-storage", MountPath: "/data/db"}},
+					Name:    "mongo",
+					Image:   defaults.Image(defaults.Images.Mongo),
+					Command: []string{"mongod", "--config", mongodConfigDir + "/" + MongodConfigKey},
+					Ports:   []corev1.ContainerPort{{ContainerPort: 27017}},
+					// Members are restarted one at a time, waiting for the previous member to become ready
+					ReadinessProbe: &corev1.Probe{
+						Handler: corev1.Handler{
+							Exec: &corev1.ExecAction{Command: []string{"sh", "-c", memberReadyScript}},
+						},
+						InitialDelaySeconds: 5,
+						PeriodSeconds:       10,
+						TimeoutSeconds:      5,
+					},
+					Resources: *defaults.Resources.DeepCopy(),
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: DataVolume, MountPath: dataDir},
+						{Name: mongodConfigVolume, MountPath: mongodConfigDir, ReadOnly: true},
+					},
 				},
+			},
+			Volumes: []corev1.Volume{
 				{
-					Name:  "mongo-sidecar",
-					Image: "cvallance/mongo-k8s-sidecar",
-					Env:   []corev1.EnvVar{{Name: "MONGO_SIDECAR_POD_LABELS", Value: "role=mongo,environment=test"}},
+					Name: mongodConfigVolume,
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+						},
+					},
 				},
 			},
 		},
 	}
 	ss.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
 		{
-			ObjectMeta: metav1.ObjectMeta{Name: "mongo-persistent-storage"},
+			ObjectMeta: metav1.ObjectMeta{Name: DataVolume},
 			Spec: corev1.PersistentVolumeClaimSpec{
 				AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
 				Resources: corev1.ResourceRequirements{
@@ -94,22 +134,94 @@ func SetStatefulSetFields(ss *appsv1.StatefulSet, service *corev1.Service, mongo
 			},
 		},
 	}
+	if defaults.StorageClassName != "" {
+		storageClassName := defaults.StorageClassName
+		ss.Spec.VolumeClaimTemplates[0].Spec.StorageClassName = &storageClassName
+	}
+	if ephemeral {
+		ss.Spec.VolumeClaimTemplates = nil
+		ss.Spec.Template.Spec.Volumes = append(ss.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name:         DataVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+
+	SetDefaultMetadata(ss, defaults)
 }
 
 // SetServiceFields sets fields on the Service object
 func SetServiceFields(service *corev1.Service, mongo metav1.Object) {
-	copyLabels := mongo.GetLabels()
-	if copyLabels == nil {
-		copyLabels = map[string]string{}
-	}
-	labels := map[string]string{}
-	for k, v := range copyLabels {
-		labels[k] = v
+	service.Labels = Labels(mongo, ComponentReplicaSet)
+
+	service.Spec.Ports = []corev1.ServicePort{
+		{Name: "mongodb", Port: 27017, TargetPort: intstr.IntOrString{IntVal: 27017, Type: intstr.Int}},
 	}
-	service.Labels = labels
+	service.Spec.Selector = SelectorLabels(mongo, ComponentReplicaSet)
+}
+
+// SetMemberServiceFields sets fields on the headless Service governing the StatefulSet running the members of the
+// component.  It only provides the DNS names of the members, clients connect through the Service of the replica set.
+func SetMemberServiceFields(service *corev1.Service, mongo metav1.Object, component string) {
+	service.Labels = Labels(mongo, component)
 
+	service.Spec.ClusterIP = corev1.ClusterIPNone
+	service.Spec.PublishNotReadyAddresses = true
 	service.Spec.Ports = []corev1.ServicePort{
-		{Port: 27017, TargetPort: intstr.IntOrString{IntVal: 27017, Type: intstr.Int}},
+		{Name: "mongodb", Port: 27017, TargetPort: intstr.IntOrString{IntVal: 27017, Type: intstr.Int}},
+	}
+	service.Spec.Selector = SelectorLabels(mongo, component)
+}
+
+// SetDefaultMetadata adds the labels and annotations from the operator configuration to obj.  Labels and
+// annotations already set on obj take precedence.  They are not added to Pod templates, so that changing them
+// does not restart the members of every instance.
+func SetDefaultMetadata(obj metav1.Object, defaults *operatorconfig.Config) {
+	obj.SetLabels(addMissing(obj.GetLabels(), defaults.Labels))
+	obj.SetAnnotations(addMissing(obj.GetAnnotations(), defaults.Annotations))
+}
+
+// PinDefaultImages keeps the containers of template at the default images recorded in the annotations of the
+// existing object, so that changing the images of the operator configuration only applies to new instances.  The
+// images are recorded in the annotations of obj.  Overrides of the spec must be merged afterwards to take
+// precedence.
+func PinDefaultImages(obj metav1.Object, template *corev1.PodTemplateSpec, existing map[string]string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for i := range template.Spec.Containers {
+		c := &template.Spec.Containers[i]
+		key := DefaultImageAnnotationPrefix + c.Name
+		if image := existing[key]; image != "" {
+			c.Image = image
+		}
+		annotations[key] = c.Image
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// addMissing adds the entries of src missing from dst
+func addMissing(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = map[string]string{}
+	}
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+// ContainerImage returns the image of the named container in the Pod template, or "" if there is no such container
+func ContainerImage(template *corev1.PodTemplateSpec, name string) string {
+	for _, c := range template.Spec.Containers {
+		if c.Name == name {
+			return c.Image
+		}
 	}
-	service.Spec.Selector = map[string]string{"mongodb-statefulset": mongo.GetName()}
+	return ""
 }